@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// slugKey identifies the URL path of a page: pages on the same site
+// root in the same language must not share a slug.
+type slugKey struct {
+	root int
+	lang int
+	slug string
+}
+
+// slugAudit writes the pages in uids with an empty slug and the groups
+// of pages with the same slug on the same site and language. It
+// returns the number of problems found.
+func (m *mysql) slugAudit(w io.Writer, uids []int) (int, error) {
+	var problems int
+	groups := make(map[slugKey][]int)
+	for _, uid := range uids {
+		slug := m.slugs[uid]
+		if slug == "" {
+			problems++
+			if _, err := fmt.Fprintf(w, "empty slug: %d\n", uid); err != nil {
+				return problems, err
+			}
+			continue
+		}
+		k := slugKey{root: m.root(uid), lang: m.langs[uid], slug: slug}
+		groups[k] = append(groups[k], uid)
+	}
+	keys := make([]slugKey, 0, len(groups))
+	for k, group := range groups {
+		if len(group) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.root != b.root {
+			return a.root < b.root
+		}
+		if a.lang != b.lang {
+			return a.lang < b.lang
+		}
+		return a.slug < b.slug
+	})
+	for _, k := range keys {
+		group := groups[k]
+		sort.Ints(group)
+		problems++
+		_, err := fmt.Fprintf(w, "duplicate slug %s (root %d, language %d): %s\n", k.slug, k.root, k.lang, intsToString(group, " "))
+		if err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
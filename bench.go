@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// newSynthetic returns an in-memory tree of n pages below a single
+// site root, with pages spread over depth levels.
+func newSynthetic(n, depth int) *mysql {
+	m := &mysql{
+		pages:   make(map[int]int),
+		sorting: make(map[int]int),
+		domains: map[int]string{1: "example.com"},
+		exclude: make(map[int]bool),
+		rootsOf: make(map[int]int),
+		locked:  make(map[int]bool),
+		roots:   []int{1},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	levels := make([][]int, depth+1)
+	levels[0] = []int{1}
+	m.pages[1] = 0
+	for uid := 2; uid <= n; uid++ {
+		level := 1 + uid%depth
+		for len(levels[level-1]) == 0 {
+			level--
+		}
+		parents := levels[level-1]
+		pid := parents[rnd.Intn(len(parents))]
+		m.pages[uid] = pid
+		m.sorting[uid] = uid
+		levels[level] = append(levels[level], uid)
+	}
+	return m
+}
+
+// benchmark times the tree traversals on a synthetic tree.
+func benchmark(w io.Writer, n, depth int) {
+	start := time.Now()
+	m := newSynthetic(n, depth)
+	fmt.Fprintf(w, "build: %d pages, depth %d in %v\n", len(m.pages), depth, time.Since(start))
+
+	start = time.Now()
+	uids := m.children(1, nil)
+	fmt.Fprintf(w, "children: %d pages in %v\n", len(uids), time.Since(start))
+
+	for _, run := range []string{"cold", "cached"} {
+		start = time.Now()
+		for _, uid := range uids {
+			m.root(uid)
+		}
+		fmt.Fprintf(w, "root (%s): %d pages in %v\n", run, len(uids), time.Since(start))
+	}
+}
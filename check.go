@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkWriter sends a HEAD request to the URL of each record and
+// writes the URLs with their status code, in the order of records.
+type checkWriter struct {
+	ctx         context.Context
+	client      *http.Client
+	w           *bufio.Writer
+	concurrency int
+	urls        []string
+}
+
+func newCheckWriter(ctx context.Context, w io.Writer, concurrency int, timeout time.Duration, follow bool) *checkWriter {
+	client := &http.Client{Timeout: timeout}
+	if !follow {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return &checkWriter{ctx: ctx, client: client, w: bufio.NewWriter(w), concurrency: concurrency}
+}
+
+func (c *checkWriter) write(r *record) error {
+	c.urls = append(c.urls, r.URL)
+	return nil
+}
+
+// head returns the status code of a HEAD request to u.
+func (c *checkWriter) head(u string) (int, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// close checks the URLs and writes the results, followed by a
+// summary of the URLs that did not answer with a 2xx status.
+func (c *checkWriter) close() error {
+	status := make([]int, len(c.urls))
+	errs := make([]error, len(c.urls))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < c.concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				status[i], errs[i] = c.head(c.urls[i])
+			}
+		}()
+	}
+	for i := range c.urls {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	var failed int
+	for i, u := range c.urls {
+		if errs[i] != nil {
+			failed++
+			log.Printf("warning: cannot check %s: %v", u, errs[i])
+			fmt.Fprintf(c.w, "%s error\n", u)
+			continue
+		}
+		if status[i]/100 != 2 {
+			failed++
+		}
+		fmt.Fprintf(c.w, "%s %d\n", u, status[i])
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		log.Printf("%d of %d URLs did not answer with a 2xx status", failed, len(c.urls))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+const (
+	queryCTE = "WITH RECURSIVE t(n) AS (SELECT 1) SELECT n FROM t"
+	// querySubtree selects the pages below uid and its ancestors,
+	// given the condition on the uids in t. UNION stops at loops in
+	// the tree.
+	querySubtree = "WITH RECURSIVE " +
+		"down(uid) AS (SELECT uid FROM pages WHERE uid=? UNION SELECT p.uid FROM pages p JOIN down ON p.pid=down.uid), " +
+		"up(uid,pid) AS (SELECT uid,pid FROM pages WHERE uid=? UNION SELECT p.uid,p.pid FROM pages p JOIN up ON p.uid=up.pid), " +
+		"t(uid) AS (SELECT uid FROM down UNION SELECT uid FROM up) " +
+		"SELECT %s FROM pages WHERE %s"
+	// queryAncestors selects uid and its ancestors, enough to find
+	// its root without reading the rest of the tree.
+	queryAncestors = "WITH RECURSIVE " +
+		"up(uid,pid) AS (SELECT uid,pid FROM pages WHERE uid=? UNION SELECT p.uid,p.pid FROM pages p JOIN up ON p.uid=up.pid), " +
+		"t(uid) AS (SELECT uid FROM up) " +
+		"SELECT %s FROM pages WHERE %s"
+	// inSubtree and translatedInSubtree are the conditions of the
+	// subtree queries, the second also selecting the translations,
+	// which are not below their default language page.
+	inSubtree           = "uid IN (SELECT uid FROM t)"
+	translatedInSubtree = inSubtree + " OR l10n_parent IN (SELECT uid FROM t)"
+	// belowAncestors also selects the subpages of the ancestors.
+	belowAncestors = " OR pid IN (SELECT uid FROM up)"
+)
+
+// hasCTE returns true if the server supports recursive common
+// table expressions (MySQL 8, MariaDB 10.2).
+func (m *mysql) hasCTE(ctx context.Context) bool {
+	rows, err := m.queryContext(ctx, queryCTE)
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// checkSubtree enables loading only the subtree of opts.subtree, or
+// only its ancestors with opts.ancestors, if the server supports it.
+// Else the whole pages table is loaded.
+func (m *mysql) checkSubtree(ctx context.Context) {
+	if m.opts.subtree <= 0 || m.opts.batch > 0 {
+		return
+	}
+	if m.cte = m.hasCTE(ctx); !m.cte {
+		log.Print("warning: the server does not support WITH RECURSIVE, loading all pages")
+	}
+}
+
+// subtreeQuery returns the query loading cols of the pages needed
+// for opts.subtree, with their translations if languages are loaded
+// and the subpages of the ancestors with opts.siblings.
+func (m *mysql) subtreeQuery(cols string) (string, []interface{}) {
+	where := inSubtree
+	if m.opts.languages || m.opts.pageLangs {
+		where = translatedInSubtree
+	}
+	if m.opts.siblings {
+		where += belowAncestors
+	}
+	if m.opts.ancestors {
+		return fmt.Sprintf(queryAncestors, cols, where), []interface{}{m.opts.subtree}
+	}
+	return fmt.Sprintf(querySubtree, cols, where), []interface{}{m.opts.subtree, m.opts.subtree}
+}
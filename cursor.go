@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cursor is the state of -cursor-file: the latest tstamp output,
+// and the pages output with that tstamp as "source uid", so that
+// the next run can include pages modified later in that second
+// without repeating these.
+type cursor struct {
+	ts   int64
+	seen map[string]bool
+}
+
+func cursorKey(source string, uid int) string {
+	return source + " " + strconv.Itoa(uid)
+}
+
+// readCursor returns the cursor stored in the file at path, or a
+// zero cursor if the file does not exist yet. The first line is the
+// tstamp, followed by the pages output with it, one per line.
+func readCursor(path string) (*cursor, error) {
+	c := &cursor{seen: make(map[string]bool)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty cursor in %s", path)
+	}
+	if c.ts, err = strconv.ParseInt(strings.TrimSpace(sc.Text()), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid cursor in %s: %v", path, err)
+	}
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			c.seen[line] = true
+		}
+	}
+	return c, sc.Err()
+}
+
+// writeCursor stores c in the cursor file at path. The file is
+// replaced by renaming, so that an interrupted write does not
+// leave a broken cursor.
+func writeCursor(path string, c *cursor) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "%d\n", c.ts)
+	for key := range c.seen {
+		fmt.Fprintf(w, "%s\n", key)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// unseen drops from uids of m the pages already output with the
+// tstamp of c.
+func (c *cursor) unseen(m *mysql, uids []int) []int {
+	return filterInts(uids, func(uid int) bool {
+		return m.tstamps[uid] != c.ts || !c.seen[cursorKey(m.source, uid)]
+	})
+}
+
+// advance returns the cursor after outputting uids of each source,
+// keeping the pages already seen if the latest tstamp is unchanged.
+func (c *cursor) advance(sources []*mysql, uids [][]int) *cursor {
+	next := &cursor{ts: c.ts, seen: make(map[string]bool)}
+	for i, m := range sources {
+		if ts := m.maxTstamp(uids[i]); ts > next.ts {
+			next.ts = ts
+		}
+	}
+	if next.ts == c.ts {
+		for key := range c.seen {
+			next.seen[key] = true
+		}
+	}
+	for i, m := range sources {
+		for _, uid := range uids[i] {
+			if m.tstamps[uid] == next.ts {
+				next.seen[cursorKey(m.source, uid)] = true
+			}
+		}
+	}
+	return next
+}
+
+// maxTstamp returns the latest tstamp of uids, or zero.
+func (m *mysql) maxTstamp(uids []int) int64 {
+	var ts int64
+	for _, uid := range uids {
+		if m.tstamps[uid] > ts {
+			ts = m.tstamps[uid]
+		}
+	}
+	return ts
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCursorSameSecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursor")
+	m := &mysql{source: "db", tstamps: map[int]int64{1: 100, 2: 200, 3: 200}}
+	cur, err := readCursor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// first run outputs everything
+	uids := cur.unseen(m, []int{1, 2, 3})
+	if err := writeCursor(path, cur.advance([]*mysql{m}, [][]int{uids})); err != nil {
+		t.Fatal(err)
+	}
+	// 4 is modified in the same second as the latest page output
+	m.tstamps[4] = 200
+	if cur, err = readCursor(path); err != nil {
+		t.Fatal(err)
+	}
+	if cur.ts != 200 {
+		t.Errorf("cursor at %d, want 200", cur.ts)
+	}
+	since := filterInts([]int{1, 2, 3, 4}, func(uid int) bool {
+		return m.tstamps[uid] >= cur.ts
+	})
+	uids = cur.unseen(m, since)
+	if want := []int{4}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("second run outputs %v, want %v", uids, want)
+	}
+	next := cur.advance([]*mysql{m}, [][]int{uids})
+	if next.ts != 200 || len(next.seen) != 3 {
+		t.Errorf("cursor after second run at %d with %d pages seen, want 200 and 3", next.ts, len(next.seen))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+const (
+	queryVersion = "SELECT VERSION()"
+	queryTable   = "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=?"
+	queryCount   = "SELECT COUNT(*) FROM %s"
+)
+
+// diagTables lists the tables reported by -diagnostics, with the
+// columns whose presence changes how pages are loaded.
+var diagTables = []struct {
+	name    string
+	columns []string
+}{
+	{"pages", []string{"is_siteroot", "slug", "doktype", "hidden", "no_index", "mount_pid", "l18n_cfg", "extendToSubpages"}},
+	{"sys_domain", []string{"redirectTo", "hidden"}},
+	{"sys_template", nil},
+	{"sys_language", nil},
+	{"pages_language_overlay", nil},
+}
+
+// diagnose writes the redacted dsn, the server version and which of diagTables and
+// their columns exist, with their row counts. It only reads
+// metadata and counts, so it works on schemas that fail to load.
+func diagnose(ctx context.Context, w io.Writer, dsn string, printSQL bool) error {
+	db, err := connect(ctx, dsn, printSQL)
+	if err != nil {
+		return err
+	}
+	m := &mysql{db: db, opts: loadOptions{printSQL: printSQL}}
+	defer m.close()
+	if _, err := fmt.Fprintf(w, "dsn: %s\n", redactDSN(dsn)); err != nil {
+		return err
+	}
+	var version string
+	if err := m.queryValue(ctx, &version, queryVersion); err != nil {
+		return fmt.Errorf("cannot read server version: %v", err)
+	}
+	if _, err := fmt.Fprintf(w, "version: %s\n", version); err != nil {
+		return err
+	}
+	for _, t := range diagTables {
+		var n int
+		if err := m.queryValue(ctx, &n, queryTable, t.name); err != nil {
+			return fmt.Errorf("cannot read tables: %v", err)
+		}
+		if n == 0 {
+			if _, err := fmt.Fprintf(w, "%s: missing\n", t.name); err != nil {
+				return err
+			}
+			continue
+		}
+		var rows int
+		if err := m.queryValue(ctx, &rows, fmt.Sprintf(queryCount, t.name)); err != nil {
+			return fmt.Errorf("cannot count %s: %v", t.name, err)
+		}
+		if _, err := fmt.Fprintf(w, "%s: %d rows\n", t.name, rows); err != nil {
+			return err
+		}
+		for _, c := range t.columns {
+			has, err := m.hasColumn(ctx, t.name, c)
+			if err != nil {
+				return err
+			}
+			state := "missing"
+			if has {
+				state = "present"
+			}
+			if _, err := fmt.Fprintf(w, "%s.%s: %s\n", t.name, c, state); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// queryValue scans the single value selected by query into dest.
+func (m *mysql) queryValue(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	rows, err := m.queryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(dest); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
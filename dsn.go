@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// checkDSN reports syntax errors in dsn before connecting, so they
+// are not confused with connectivity problems.
+func checkDSN(dsn string) error {
+	if _, err := driver.ParseDSN(dsn); err != nil {
+		return fmt.Errorf("invalid DSN syntax (expected user:password@tcp(host:port)/dbname): %v", err)
+	}
+	return nil
+}
+
+// redactDSN returns dsn with the password masked, suitable for logs.
+func redactDSN(dsn string) string {
+	cfg, err := driver.ParseDSN(dsn)
+	if err != nil {
+		return "<invalid DSN>"
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = "xxxxx"
+	}
+	return cfg.FormatDSN()
+}
+
+// dsnName returns a name for the database of dsn, without credentials.
+func dsnName(dsn string) string {
+	cfg, err := driver.ParseDSN(dsn)
+	if err != nil {
+		return "<invalid DSN>"
+	}
+	return cfg.Addr + "/" + cfg.DBName
+}
+
+// readDefaultsFile builds a DSN from the [client] section of the
+// MySQL option file fname, as read by the mysql client.
+func readDefaultsFile(fname string) (string, error) {
+	opts := make(map[string]string)
+	var client bool
+	err := readLines(fname, func(line string) error {
+		if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!") {
+			return nil
+		}
+		if strings.HasPrefix(line, "[") {
+			client = strings.TrimSpace(strings.Trim(line, "[]")) == "client"
+			return nil
+		}
+		if !client {
+			return nil
+		}
+		k, v, _ := strings.Cut(line, "=")
+		k = strings.ReplaceAll(strings.TrimSpace(k), "_", "-")
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		opts[k] = v
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(opts) == 0 {
+		return "", fmt.Errorf("%s has no [client] options", fname)
+	}
+	cfg := driver.NewConfig()
+	cfg.User = opts["user"]
+	cfg.Passwd = opts["password"]
+	cfg.DBName = opts["database"]
+	if socket := opts["socket"]; socket != "" {
+		cfg.Net = "unix"
+		cfg.Addr = socket
+	} else {
+		host, port := opts["host"], opts["port"]
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			port = "3306"
+		}
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(host, port)
+	}
+	return cfg.FormatDSN(), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// uidMap is a repeatable flag of uid=value pairs.
+type uidMap map[int]string
+
+func (u uidMap) String() string {
+	pairs := make([]string, 0, len(u))
+	for uid, v := range u {
+		pairs = append(pairs, fmt.Sprintf("%d=%s", uid, v))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (u uidMap) Set(s string) error {
+	a, b, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%q is not in the form uid=value", s)
+	}
+	uid, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil {
+		return err
+	}
+	u[uid] = strings.TrimSpace(b)
+	return nil
+}
+
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// readLines calls fn for each line of fname, skipping blank lines
+// and comments starting with #.
+func readLines(fname string, fn func(line string) error) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", fname, n, err)
+		}
+	}
+	return sc.Err()
+}
+
+// domainFlags are the flags whose values give away the domains of
+// the sites, left out by setFlags with -redact-domains.
+var domainFlags = map[string]bool{
+	"domain-filter":  true,
+	"default-domain": true,
+	"canonical-map":  true,
+	"url-override":   true,
+	"site-config":    true,
+}
+
+// setFlags returns the flags set on the command line, with the
+// passwords of DSNs and the -post-auth-header value masked. With
+// redact, the flags naming domains are left out.
+func setFlags(redact bool) map[string]string {
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if redact && domainFlags[f.Name] {
+			return
+		}
+		v := f.Value.String()
+		switch f.Name {
+		case "dsn":
+			if dsns, ok := f.Value.(*stringsFlag); ok {
+				names := make([]string, len(*dsns))
+				for i, dsn := range *dsns {
+					names[i] = redactDSN(dsn)
+				}
+				v = strings.Join(names, ",")
+			}
+		case "added-since-dsn":
+			v = redactDSN(v)
+		case "post-auth-header":
+			v = "xxxxx"
+		}
+		flags[f.Name] = v
+	})
+	return flags
+}
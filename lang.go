@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+)
+
+const (
+	queryLanguages = "SELECT uid,language_isocode FROM sys_language"
+	queryOverlays  = "SELECT uid,pid,sys_language_uid FROM pages_language_overlay"
+)
+
+// loadLanguages reads the ISO codes of the languages. The table
+// does not exist since TYPO3 11, in which case languages are only
+// known by their uid.
+func (m *mysql) loadLanguages(ctx context.Context) error {
+	rows, err := m.queryContext(ctx, queryLanguages)
+	if err != nil {
+		log.Printf("warning: cannot load sys_language, using language uids: %v", err)
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			uid  int
+			code string
+		)
+		if err := rows.Scan(&uid, &code); err != nil {
+			return fmt.Errorf("cannot read languages row: %v", err)
+		}
+		m.isocodes[uid] = code
+	}
+	return rows.Err()
+}
+
+// loadOverlays reads the translations of pages stored in the
+// pages_language_overlay table before TYPO3 9. The pid of an overlay
+// is its default language page. Overlays are added as translated
+// pages next to it, as in later versions, with the negative of their
+// uid so that they do not collide with uids of pages.
+func (m *mysql) loadOverlays(ctx context.Context) error {
+	rows, err := m.queryContext(ctx, queryOverlays)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid, parent, lang int
+		if err := rows.Scan(&uid, &parent, &lang); err != nil {
+			return fmt.Errorf("cannot read overlays row: %v", err)
+		}
+		pid, ok := m.pages[parent]
+		if !ok || lang <= 0 {
+			continue
+		}
+		m.pages[-uid] = pid
+		m.sorting[-uid] = m.sorting[parent]
+		m.langs[-uid] = lang
+		m.l10n[parent] = append(m.l10n[parent], -uid)
+		m.l10nOf[-uid] = parent
+	}
+	return rows.Err()
+}
+
+// pageUIDs returns uids without the overlays loaded by
+// loadOverlays, whose negative uids are not pages.uid values.
+func pageUIDs(uids []int) []int {
+	return filterInts(uids, func(uid int) bool {
+		return uid > 0
+	})
+}
+
+// isTranslation returns true if uid is a translated page record.
+func (m *mysql) isTranslation(uid int) bool {
+	return m.langs[uid] != 0
+}
+
+// l18nHideDefault is the pages.l18n_cfg bit that hides the default
+// language version of a page.
+const l18nHideDefault = 1
+
+// inLanguage returns true if uid is shown in language lang: either
+// a translation to lang or, for the default language, a page that
+// does not hide its default language version.
+func (m *mysql) inLanguage(uid, lang int) bool {
+	if lang == 0 {
+		return !m.isTranslation(uid) && m.l18ncfg[uid]&l18nHideDefault == 0
+	}
+	return m.langs[uid] == lang
+}
+
+// langCode returns the code used for language lang of the site of
+// uid in hreflang sets: from the site configuration, else from
+// sys_language, else the language uid.
+func (m *mysql) langCode(uid, lang int) string {
+	if sc, ok := m.sites[m.root(uid)]; ok {
+		if code := sc.langCode(lang); code != "" {
+			return code
+		}
+	}
+	if code, ok := m.isocodes[lang]; ok && code != "" {
+		return code
+	}
+	return strconv.Itoa(lang)
+}
+
+type alternate struct {
+	Lang string `json:"lang"`
+	URL  string `json:"url"`
+}
+
+type hreflangSet struct {
+	UID        int         `json:"uid"`
+	Alternates []alternate `json:"alternates"`
+}
+
+// hreflang returns the URLs of uid and its translations, or nil
+// if uid is a translation itself or has no URL. The default language
+// URL is listed with its code and again as x-default.
+func (m *mysql) hreflang(uid int) *hreflangSet {
+	if m.isTranslation(uid) {
+		return nil
+	}
+	_, u := m.publicURL(uid)
+	if u == "" {
+		return nil
+	}
+	set := &hreflangSet{UID: uid, Alternates: []alternate{
+		{Lang: m.langCode(uid, 0), URL: u},
+		{Lang: "x-default", URL: u},
+	}}
+	trans := m.l10n[uid]
+	sort.Slice(trans, func(i, j int) bool {
+		return m.langs[trans[i]] < m.langs[trans[j]]
+	})
+	for _, tid := range trans {
+		if _, u := m.publicURL(tid); u != "" {
+			set.Alternates = append(set.Alternates, alternate{Lang: m.langCode(tid, m.langs[tid]), URL: u})
+		}
+	}
+	return set
+}
+
+// writeHreflang writes one JSON hreflang set per line for each of
+// the default language pages in uids.
+func (m *mysql) writeHreflang(w io.Writer, uids []int) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	for _, uid := range uids {
+		if set := m.hreflang(uid); set != nil {
+			if err := enc.Encode(set); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
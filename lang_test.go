@@ -0,0 +1,25 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHreflangCodes(t *testing.T) {
+	m := testSite(map[int]int{1: 0, 2: 1, 3: 1, 4: 1})
+	m.langs = map[int]int{3: 1, 4: 2}
+	m.l10n = map[int][]int{2: {4, 3}}
+	m.l10nOf = map[int]int{3: 2, 4: 2}
+	m.isocodes = map[int]string{2: "fr"}
+	m.sites = map[int]*siteConfig{1: {RootPageID: 1, Languages: []siteLanguage{
+		{LanguageID: 0, Hreflang: "en-GB"},
+		{LanguageID: 1, ISOCode: "de"},
+	}}}
+	var got []string
+	for _, a := range m.hreflang(2).Alternates {
+		got = append(got, a.Lang)
+	}
+	if want := []string{"en-GB", "x-default", "de", "fr"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hreflang codes = %v, want %v", got, want)
+	}
+}
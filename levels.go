@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	queryPageByUID      = "SELECT %s FROM pages WHERE uid=?"
+	queryPagesByPID     = "SELECT %s FROM pages WHERE pid IN (%s)"
+	queryPagesByL10nPID = "SELECT %s FROM pages WHERE l10n_parent IN (%s)"
+)
+
+// loadLevels loads the ancestors of opts.subtree one by one, then
+// its subpages level by level, with at most opts.batch pids in each
+// query. With opts.ancestors, only the ancestors are loaded. The
+// translations of the subpages are on their level; those of the
+// ancestors are loaded apart if languages are, and so are the
+// subpages of the ancestors with opts.siblings. scan loads the pages
+// of a query and returns their uids.
+func (m *mysql) loadLevels(cols string, scan func(string, []interface{}) ([]int, error)) error {
+	var chain []int
+	for uid := m.opts.subtree; uid != 0; uid = m.pages[uid] {
+		if _, ok := m.pages[uid]; ok {
+			break // loop in the parent chain
+		}
+		uids, err := scan(fmt.Sprintf(queryPageByUID, cols), []interface{}{uid})
+		if err != nil {
+			return err
+		}
+		if len(uids) == 0 {
+			break
+		}
+		chain = append(chain, uid)
+	}
+	if m.opts.languages || m.opts.pageLangs {
+		if _, err := scanBatches(queryPagesByL10nPID, cols, chain, m.opts.batch, scan); err != nil {
+			return err
+		}
+	}
+	if m.opts.siblings && len(chain) > 1 {
+		if _, err := scanBatches(queryPagesByPID, cols, chain[1:], m.opts.batch, scan); err != nil {
+			return err
+		}
+	}
+	if m.opts.ancestors {
+		return nil
+	}
+	level := []int{m.opts.subtree}
+	for len(level) > 0 {
+		next, err := scanBatches(queryPagesByPID, cols, level, m.opts.batch, scan)
+		if err != nil {
+			return err
+		}
+		level = next
+	}
+	return nil
+}
+
+// scanBatches runs query for ids, at most batch at a time, and
+// returns the uids loaded.
+func scanBatches(query, cols string, ids []int, batch int, scan func(string, []interface{}) ([]int, error)) ([]int, error) {
+	var loaded []int
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	for _, chunk := range chunkInts(ids, batch) {
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?,", len(chunk)), ",")
+		uids, err := scan(fmt.Sprintf(query, cols, marks), args)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, uids...)
+	}
+	return loaded, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// fakeLevels returns a scan function for loadLevels that selects
+// from pages, as uid : pid, the way the level queries do.
+func fakeLevels(m *mysql, pages map[int]int) func(string, []interface{}) ([]int, error) {
+	return func(query string, args []interface{}) ([]int, error) {
+		ids := make(map[int]bool)
+		for _, a := range args {
+			ids[a.(int)] = true
+		}
+		var uids []int
+		for uid, pid := range pages {
+			var ok bool
+			switch {
+			case strings.Contains(query, "WHERE uid=?"):
+				ok = ids[uid]
+			case strings.Contains(query, "WHERE pid IN"):
+				ok = ids[pid]
+			}
+			if ok && m.addPage(&pageRow{uid: uid, pid: pid}) {
+				uids = append(uids, uid)
+			}
+		}
+		return uids, nil
+	}
+}
+
+func TestLoadLevelsSiblings(t *testing.T) {
+	// 1 is the root, 3 the subtree; 2 and 4 are not in the chain.
+	pages := map[int]int{1: 0, 2: 1, 3: 1, 4: 1, 5: 3, 6: 5, 7: 2}
+	tests := []struct {
+		name     string
+		siblings bool
+		childs   int
+	}{
+		{"chain only", false, 1},
+		{"siblings", true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mysql{
+				opts:    loadOptions{subtree: 3, batch: 2, siblings: tt.siblings},
+				pages:   make(map[int]int),
+				sorting: make(map[int]int),
+			}
+			if err := m.loadLevels("uid,pid", fakeLevels(m, pages)); err != nil {
+				t.Fatal(err)
+			}
+			if got := m.childCount(1); got != tt.childs {
+				t.Errorf("root has %d children, want %d", got, tt.childs)
+			}
+			for _, uid := range []int{5, 6} {
+				if _, ok := m.pages[uid]; !ok {
+					t.Errorf("subpage %d not loaded", uid)
+				}
+			}
+			if _, ok := m.pages[7]; ok {
+				t.Error("subpage 7 of a sibling loaded")
+			}
+		})
+	}
+}
@@ -1,125 +1,559 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// shellName matches valid shell variable names.
+var shellName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// exitInterrupted is the exit code used when a signal stops the run.
+const exitInterrupted = 130
+
+const (
+	queryPages         = "SELECT %s FROM pages"
+	queryDomains       = "SELECT pid,domainName,forced,%s FROM sys_domain%s ORDER BY hidden ASC, sorting ASC"
+	queryColumn        = "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND COLUMN_NAME=?"
+	queryTemplateRoots = "SELECT pid FROM sys_template WHERE root=1 AND deleted=0 AND hidden=0"
+)
+
+// Doktypes of pages with special handling.
 const (
-	queryPages   = "SELECT uid,pid,is_siteroot FROM pages"
-	queryDomains = "SELECT pid,domainName,forced FROM sys_domain ORDER BY sorting ASC"
+	doktypeMountPoint = 7
+	doktypeFolder     = 254
 )
 
+// loadOptions selects the optional data loaded from the database
+// and how it is queried.
+type loadOptions struct {
+	slugs         bool   // load pages.slug (TYPO3 9+)
+	templateRoots bool   // pages with a root sys_template are site roots
+	protected     bool   // load pages.fe_group and skip access restricted subtrees
+	languages     bool   // load the language and translation parent of pages
+	printSQL      bool   // log queries before running them
+	titles        bool   // load pages.title
+	noindex       bool   // load pages.no_search and pages.no_index (EXT:seo)
+	tstamps       bool   // load pages.tstamp
+	redirects     bool   // use the target of redirect-only domains instead of skipping them
+	doktypes      bool   // load pages.doktype
+	pageLangs     bool   // load the language of pages, without sys_language
+	l18nCfg       bool   // load pages.l18n_cfg
+	rootPredicate string // SQL expression marking site roots instead of is_siteroot or pid=0
+	subtree       int    // only load the pages below and above this uid, if the server supports it
+	ancestors     bool   // with subtree, only load its ancestors, when no subpages or child counts are needed
+	batch         int    // with subtree, load it level by level with at most this many pids per query
+	siblings      bool   // with subtree, also load the subpages of its ancestors, for their child counts
+	mounts        bool   // load pages.mount_pid and build slug URLs through mount points
+	skipFolders   bool   // prune the subtrees of folders (doktype 254)
+	navHide       bool   // load pages.nav_hide
+	overlays      bool   // load translations from pages_language_overlay (before TYPO3 9)
+	noSiteroot    bool   // pages has no is_siteroot column, only pid=0 pages are roots
+	hiddenDomains bool   // also load disabled (hidden) sys_domain rows
+}
+
 type mysql struct {
-	db      *sql.DB
-	pages   map[int]int      // uid : pid
-	domains map[int]string   // pid : domain
-	assoc   map[int][]string // pid : associated data
-	roots   []int            // uid of siteroot
+	db       *sql.DB
+	opts     loadOptions
+	pages    map[int]int         // uid : pid
+	sorting  map[int]int         // uid : sorting
+	slugs    map[int]string      // uid : slug
+	titles   map[int]string      // uid : title
+	tstamps  map[int]int64       // uid : tstamp
+	doktypes map[int]int         // uid : doktype
+	l18ncfg  map[int]int         // uid : l18n_cfg bits
+	mounts   map[int]int         // mounted uid : mount point uid
+	domains  map[int]string      // pid : domain
+	forced   map[int]bool        // pid : sys_domain.forced of its domain
+	redirs   map[int]string      // pid : redirectTo of a root with only redirecting domains
+	assoc    map[int][]string    // pid : associated data
+	nulls    map[int][]bool      // pid : associated data that is NULL
+	sites    map[int]*siteConfig // rootPageId : site configuration
+	exclude  map[int]bool        // uid : prune subtree
+	rootsOf  map[int]int         // uid : cached root
+	nsubs    map[int]int         // pid : number of loaded subpages, not pruned nor translations, built on first use
+	urls     uidMap              // uid : overridden URL
+	hosts    uidMap              // root : canonical host
+	locked   map[int]bool        // uid : access restricted by fe_group
+	extends  map[int]bool        // uid : fe_group restriction applies to subpages
+	noindex  map[int]bool        // uid : excluded from search engines
+	navHide  map[int]bool        // uid : hidden in menus
+	langs    map[int]int         // uid : sys_language_uid
+	l10n     map[int][]int       // uid : uids of translations
+	l10nOf   map[int]int         // uid : default language uid of a translation
+	isocodes map[int]string      // sys_language_uid : ISO code
+	cycle    []int               // first loop of pids found
+	seo      bool                // pages.no_index exists
+	cte      bool                // load the subtree with recursive SQL
+	source   string              // name of the database
+	fallback string              // domain of pages without one
+	slash    string              // trailing slash of slug URLs: add, remove or keep
+	redactor *redactor           // placeholders of domains in the output, if set
+	dump     bool                // log the rows scanned by query
+	pageType int                 // type parameter of index.php URLs, if not 0
+	roots    []int               // uid of siteroot
 }
 
-func newMysql(dsn string) (*mysql, error) {
+// connect opens and checks a connection to the database of dsn.
+func connect(ctx context.Context, dsn string, printSQL bool) (*sql.DB, error) {
+	if printSQL {
+		log.Printf("connecting to %s", redactDSN(dsn))
+	}
+	if err := checkDSN(dsn); err != nil {
+		return nil, err
+	}
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
 		return nil, err
 	}
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot connect to %s: %v", redactDSN(dsn), err)
+	}
+	return db, nil
+}
+
+func newMysql(ctx context.Context, dsn string, opts loadOptions) (*mysql, error) {
+	db, err := connect(ctx, dsn, opts.printSQL)
+	if err != nil {
 		return nil, err
 	}
 	m := &mysql{
-		db:      db,
-		pages:   make(map[int]int),
-		domains: make(map[int]string),
-		assoc:   make(map[int][]string),
-		roots:   make([]int, 0),
+		db:       db,
+		opts:     opts,
+		pages:    make(map[int]int),
+		sorting:  make(map[int]int),
+		slugs:    make(map[int]string),
+		titles:   make(map[int]string),
+		tstamps:  make(map[int]int64),
+		doktypes: make(map[int]int),
+		l18ncfg:  make(map[int]int),
+		mounts:   make(map[int]int),
+		domains:  make(map[int]string),
+		forced:   make(map[int]bool),
+		redirs:   make(map[int]string),
+		assoc:    make(map[int][]string),
+		nulls:    make(map[int][]bool),
+		sites:    make(map[int]*siteConfig),
+		exclude:  make(map[int]bool),
+		rootsOf:  make(map[int]int),
+		urls:     make(uidMap),
+		locked:   make(map[int]bool),
+		extends:  make(map[int]bool),
+		noindex:  make(map[int]bool),
+		navHide:  make(map[int]bool),
+		langs:    make(map[int]int),
+		l10n:     make(map[int][]int),
+		l10nOf:   make(map[int]int),
+		isocodes: make(map[int]string),
+		roots:    make([]int, 0),
+	}
+	if opts.noindex {
+		if m.seo, err = m.hasColumn(ctx, "pages", "no_index"); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
-	if err := m.loadPages(); err != nil {
+	if opts.rootPredicate == "" && !opts.noSiteroot {
+		has, err := m.hasColumn(ctx, "pages", "is_siteroot")
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if !has {
+			log.Print("warning: pages has no is_siteroot column, only pages with pid 0 are roots")
+			m.opts.noSiteroot = true
+		}
+	}
+	m.checkSubtree(ctx)
+	if err := m.loadPages(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
-	if err := m.loadDomains(); err != nil {
+	if opts.overlays {
+		if err := m.loadOverlays(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if opts.templateRoots {
+		if err := m.loadTemplateRoots(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if opts.languages {
+		if err := m.loadLanguages(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := m.loadDomains(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
 	return m, nil
 }
 
-func (m *mysql) loadPages() error {
-	rows, err := m.db.Query(queryPages)
+func (m *mysql) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if m.opts.printSQL {
+		if len(args) > 0 {
+			log.Printf("sql: %s %v", query, args)
+		} else {
+			log.Printf("sql: %s", query)
+		}
+	}
+	return m.db.QueryContext(ctx, query, args...)
+}
+
+func (m *mysql) hasColumn(ctx context.Context, table, column string) (bool, error) {
+	rows, err := m.queryContext(ctx, queryColumn, table, column)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	var n int
+	for rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return false, fmt.Errorf("cannot read columns row: %v", err)
+		}
+	}
+	return n > 0, rows.Err()
+}
+
+func (m *mysql) close() error {
+	return m.db.Close()
+}
+
+func (m *mysql) loadPages(ctx context.Context) error {
+	var r pageRow
+	cols := []string{"uid", "pid", "is_siteroot", "sorting"}
+	if m.opts.rootPredicate != "" {
+		cols[2] = "(" + m.opts.rootPredicate + ")"
+	} else if m.opts.noSiteroot {
+		cols[2] = "NULL"
+	}
+	dest := []interface{}{&r.uid, &r.pid, &r.isroot, &r.sorting}
+	if m.opts.slugs {
+		cols = append(cols, "slug")
+		dest = append(dest, &r.slug)
+	}
+	if m.opts.titles {
+		cols = append(cols, "title")
+		dest = append(dest, &r.title)
+	}
+	if m.opts.tstamps {
+		cols = append(cols, "tstamp")
+		dest = append(dest, &r.tstamp)
+	}
+	if m.opts.doktypes {
+		cols = append(cols, "doktype")
+		dest = append(dest, &r.doktype)
+	}
+	if m.opts.mounts {
+		cols = append(cols, "mount_pid")
+		dest = append(dest, &r.mountPid)
+	}
+	if m.opts.l18nCfg {
+		cols = append(cols, "l18n_cfg")
+		dest = append(dest, &r.l18nCfg)
+	}
+	if m.opts.navHide {
+		cols = append(cols, "nav_hide")
+		dest = append(dest, &r.navHide)
+	}
+	if m.opts.protected {
+		cols = append(cols, "fe_group", "extendToSubpages")
+		dest = append(dest, &r.feGroup, &r.extendToSubpages)
+	}
+	if m.opts.noindex {
+		cols = append(cols, "no_search")
+		dest = append(dest, &r.noSearch)
+		if m.seo {
+			cols = append(cols, "no_index")
+			dest = append(dest, &r.noIndex)
+		}
+	}
+	if m.opts.languages || m.opts.pageLangs {
+		cols = append(cols, "sys_language_uid", "l10n_parent")
+		dest = append(dest, &r.lang, &r.l10nParent)
+	}
+	// scan runs query and loads the pages it selects, returning
+	// their uids if loading level by level. Pages already loaded
+	// are skipped.
+	scan := func(query string, args []interface{}) ([]int, error) {
+		rows, err := m.queryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var uids []int
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				return nil, fmt.Errorf("cannot read pages row: %v", err)
+			}
+			if !m.addPage(&r) {
+				continue
+			}
+			if m.opts.batch > 0 {
+				uids = append(uids, r.uid)
+			}
+		}
+		return uids, rows.Err()
+	}
+	if m.opts.batch > 0 {
+		return m.loadLevels(strings.Join(cols, ","), scan)
+	}
+	query, args := fmt.Sprintf(queryPages, strings.Join(cols, ",")), []interface{}(nil)
+	if m.cte {
+		query, args = m.subtreeQuery(strings.Join(cols, ","))
+	}
+	_, err := scan(query, args)
+	return err
+}
+
+// pageRow holds the columns of a pages row, as far as loaded.
+type pageRow struct {
+	pid, uid, sorting int
+	doktype, l18nCfg  int
+	mountPid          int
+	tstamp            int64
+	lang, l10nParent  int
+	noSearch, noIndex bool
+	extendToSubpages  bool
+	navHide           bool
+	isroot            sql.NullInt64 // NULL or tinyint in legacy schemas
+	slug, feGroup     sql.NullString
+	title             sql.NullString
+}
+
+// isSiteRoot tells whether the page of r is the root of a site:
+// is_siteroot (or the -root-predicate) is set, or the page is on the
+// top level and no -root-predicate is given.
+func (m *mysql) isSiteRoot(r *pageRow) bool {
+	return (r.isroot.Valid && r.isroot.Int64 != 0) || (r.pid == 0 && m.opts.rootPredicate == "")
+}
+
+// addPage stores the page of r, returning false if it was already
+// loaded.
+func (m *mysql) addPage(r *pageRow) bool {
+	uid := r.uid
+	if _, ok := m.pages[uid]; ok {
+		return false
+	}
+	m.pages[uid] = r.pid
+	m.sorting[uid] = r.sorting
+	if m.opts.slugs {
+		m.slugs[uid] = r.slug.String
+	}
+	if m.opts.titles {
+		m.titles[uid] = r.title.String
+	}
+	if m.opts.tstamps {
+		m.tstamps[uid] = r.tstamp
+	}
+	if m.opts.doktypes {
+		m.doktypes[uid] = r.doktype
+	}
+	if m.opts.skipFolders && r.doktype == doktypeFolder {
+		m.exclude[uid] = true
+	}
+	if m.opts.navHide && r.navHide {
+		m.navHide[uid] = true
+	}
+	if m.opts.mounts && r.doktype == doktypeMountPoint && r.mountPid > 0 {
+		m.addMount(uid, r.mountPid)
+	}
+	if m.opts.l18nCfg && r.l18nCfg != 0 {
+		m.l18ncfg[uid] = r.l18nCfg
+	}
+	if m.opts.protected && isProtected(r.feGroup.String) {
+		m.locked[uid] = true
+		m.extends[uid] = r.extendToSubpages
+	}
+	if m.opts.noindex && (r.noSearch || r.noIndex) {
+		m.noindex[uid] = true
+	}
+	if (m.opts.languages || m.opts.pageLangs) && r.lang > 0 {
+		m.langs[uid] = r.lang
+		m.l10n[r.l10nParent] = append(m.l10n[r.l10nParent], uid)
+		m.l10nOf[uid] = r.l10nParent
+	}
+	if m.isSiteRoot(r) {
+		m.roots = append(m.roots, uid)
+	}
+	return true
+}
+
+func (m *mysql) loadTemplateRoots(ctx context.Context) error {
+	rows, err := m.queryContext(ctx, queryTemplateRoots)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 	for rows.Next() {
-		var (
-			pid, uid int
-			isroot   bool
-		)
-		if err := rows.Scan(&uid, &pid, &isroot); err != nil {
-			return fmt.Errorf("cannot read pages row: %v", err)
+		var pid int
+		if err := rows.Scan(&pid); err != nil {
+			return fmt.Errorf("cannot read templates row: %v", err)
 		}
-		m.pages[uid] = pid
-		if isroot || pid == 0 {
-			m.roots = append(m.roots, uid)
+		if !m.isRoot(pid) {
+			m.roots = append(m.roots, pid)
 		}
 	}
-	return nil
+	return rows.Err()
 }
 
-func (m *mysql) loadDomains() error {
-	rows, err := m.db.Query(queryDomains)
+// loadDomains reads the first domain of each root. Domains that
+// only redirect elsewhere (sys_domain.redirectTo, before TYPO3 10)
+// are skipped, or replaced by their target with opts.redirects.
+// Disabled domains are skipped unless opts.hiddenDomains is set, and
+// even then only used for roots without an enabled domain.
+func (m *mysql) loadDomains(ctx context.Context) error {
+	redirectCol := "''"
+	hasRedirect, err := m.hasColumn(ctx, "sys_domain", "redirectTo")
 	if err != nil {
 		return err
 	}
+	if hasRedirect {
+		redirectCol = "redirectTo"
+	}
+	where := " WHERE hidden=0"
+	if m.opts.hiddenDomains {
+		where = ""
+	}
+	rows, err := m.queryContext(ctx, fmt.Sprintf(queryDomains, redirectCol, where))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 	for rows.Next() {
 		var (
-			pid    int
-			domain string
-			forced bool
+			pid      int
+			domain   string
+			forced   bool
+			redirect string
 		)
-		if err := rows.Scan(&pid, &domain, &forced); err != nil {
+		if err := rows.Scan(&pid, &domain, &forced, &redirect); err != nil {
 			return fmt.Errorf("cannot read domains row: %v", err)
 		}
 		if _, ok := m.domains[pid]; ok { // && !forced {
 			continue
 		}
+		domain = normalizeHost(domain)
+		if redirect != "" {
+			if !m.opts.redirects {
+				m.redirs[pid] = redirect
+				continue
+			}
+			if domain = normalizeHost(redirectHost(redirect)); domain == "" {
+				continue
+			}
+		}
 		m.domains[pid] = domain
+		m.forced[pid] = forced
+		delete(m.redirs, pid)
 	}
-	return nil
+	return rows.Err()
+}
+
+// normalizeHost lowercases and trims a host name, as host names are
+// case insensitive and sys_domain records are edited by hand.
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSpace(host))
+}
+
+// redirectHost returns the host of a redirectTo value, which may
+// be a full URL or only a domain with an optional path.
+func redirectHost(redirect string) string {
+	if u, err := url.Parse(redirect); err == nil && u.Host != "" {
+		return u.Host
+	}
+	host, _, _ := strings.Cut(redirect, "/")
+	return host
 }
 
-func (m *mysql) query(sql string, nassoc int) ([]int, error) {
-	rows, err := m.db.Query(sql)
+// query runs q and returns the uids it selects, in row order.
+// Column uidCol of each row is the uid, the nassoc other columns
+// are associated data.
+func (m *mysql) query(ctx context.Context, q string, nassoc, uidCol int) ([]int, error) {
+	rows, err := m.queryContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
-	uids := make([]int, 0)
-	assoc := make([]*string, nassoc)
-	for i := 0; i < nassoc; i++ {
-		b := ""
-		assoc[i] = &b
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if uidCol >= len(cols) {
+		return nil, fmt.Errorf("uid column %d out of range, query has %d columns", uidCol, len(cols))
 	}
+	uids := make([]int, 0)
+	assoc := make([]sql.NullString, nassoc)
 	params := make([]interface{}, nassoc+1)
 	for rows.Next() {
 		var uid int
-		params[0] = &uid
-		for i := 0; i < nassoc; i++ {
-			params[i+1] = interface{}(assoc[i])
+		params[uidCol] = &uid
+		for i, j := 0, 0; i < nassoc; i, j = i+1, j+1 {
+			if j == uidCol {
+				j++
+			}
+			params[j] = &assoc[i]
 		}
 		if err := rows.Scan(params...); err != nil {
 			return nil, fmt.Errorf("cannot scan query: %v", err)
 		}
 		data := make([]string, nassoc)
+		var nulls []bool
 		for i := 0; i < nassoc; i++ {
-			data[i] = *assoc[i]
+			data[i] = assoc[i].String
+			if !assoc[i].Valid {
+				if nulls == nil {
+					nulls = make([]bool, nassoc)
+				}
+				nulls[i] = true
+			}
 		}
 		m.assoc[uid] = data
+		if nulls != nil {
+			m.nulls[uid] = nulls
+		}
+		if m.dump {
+			log.Printf("%s: uid %d: %s", m.source, uid, dumpFields(data, nulls))
+		}
 		uids = append(uids, uid)
 	}
-	return uids, nil
+	return uids, rows.Err()
+}
+
+// dumpFields formats associated data as scanned, quoted, with NULL
+// for NULL fields.
+func dumpFields(data []string, nulls []bool) string {
+	fields := make([]string, len(data))
+	for i := range data {
+		if nulls != nil && nulls[i] {
+			fields[i] = "NULL"
+		} else {
+			fields[i] = strconv.Quote(data[i])
+		}
+	}
+	return "[" + strings.Join(fields, " ") + "]"
 }
 
 func (m *mysql) isRoot(pid int) bool {
@@ -135,33 +569,540 @@ func (m *mysql) children(pid int, pids []int) []int {
 	if pids == nil {
 		pids = make([]int, 0)
 	}
+	return m.descend(pid, pids, []int{pid})
+}
+
+// descend appends the subpages of pid to pids. The path of
+// ancestors is used to stop at loops.
+func (m *mysql) descend(pid int, pids, path []int) []int {
+	for uid := range m.pages {
+		if m.pages[uid] != pid || m.pruned(uid) {
+			continue
+		}
+		if i := indexInt(path, uid); i >= 0 {
+			m.foundCycle(append(path[i:], uid))
+			continue
+		}
+		pids = append(pids, uid)
+		pids = m.descend(uid, pids, append(path, uid))
+	}
+	return pids
+}
+
+// traverse appends the subpages of pid to pids in breadth-first
+// order if bfs is set, otherwise depth-first, with siblings in
+// their sorting order.
+func (m *mysql) traverse(pid int, pids []int, bfs bool) []int {
+	if pids == nil {
+		pids = make([]int, 0)
+	}
+	childs := make(map[int][]int)
+	for uid, p := range m.pages {
+		if !m.pruned(uid) {
+			childs[p] = append(childs[p], uid)
+		}
+	}
+	for _, uids := range childs {
+		m.sortSiblings(uids)
+	}
+	seen := map[int]bool{pid: true}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		var uid int
+		if bfs {
+			uid, queue = queue[0], queue[1:]
+		} else {
+			uid, queue = queue[len(queue)-1], queue[:len(queue)-1]
+		}
+		if uid != pid {
+			pids = append(pids, uid)
+		}
+		next := childs[uid]
+		if !bfs {
+			// pushed in reverse to pop the first sibling first
+			next = append([]int(nil), next...)
+			for i, j := 0, len(next)-1; i < j; i, j = i+1, j-1 {
+				next[i], next[j] = next[j], next[i]
+			}
+		}
+		for _, sub := range next {
+			if seen[sub] {
+				m.foundCycle(append(m.ancestors(uid), sub))
+				continue
+			}
+			seen[sub] = true
+			queue = append(queue, sub)
+		}
+	}
+	return pids
+}
+
+// foundCycle records and reports a loop in the page tree.
+func (m *mysql) foundCycle(path []int) {
+	if m.cycle != nil {
+		return
+	}
+	m.cycle = append([]int(nil), path...)
+	log.Printf("warning: cycle in page tree: %s", intsToString(m.cycle, " -> "))
+}
+
+// isProtected returns true if the fe_group list requires a frontend
+// login: any user group, or -2 (show at any login). A lone -1 (hide
+// at login) keeps the page public.
+func isProtected(feGroup string) bool {
+	for _, g := range strings.Split(feGroup, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(g))
+		if err != nil {
+			continue
+		}
+		if id > 0 || id == -2 {
+			return true
+		}
+	}
+	return false
+}
+
+// pruned returns true if uid and its subtree are skipped. Like the
+// frontend, the fe_group of a page only restricts its subpages if
+// extendToSubpages is set.
+func (m *mysql) pruned(uid int) bool {
+	return m.exclude[uid] || (m.locked[uid] && m.extends[uid])
+}
+
+// excluded returns true if uid is access restricted, or if it or any
+// of its ancestors is pruned.
+func (m *mysql) excluded(uid int) bool {
+	if m.locked[uid] {
+		return true
+	}
+	for i := 0; i <= len(m.pages); i++ {
+		if m.pruned(uid) {
+			return true
+		}
+		pid, ok := m.pages[uid]
+		if !ok || pid == 0 {
+			return false
+		}
+		uid = pid
+	}
+	return false
+}
+
+// childCount returns the number of subpages of uid that are not
+// pruned, as walked by children and directChildren. Translations
+// are not counted, as they are versions of the subpages.
+func (m *mysql) childCount(uid int) int {
+	if m.nsubs == nil {
+		m.nsubs = make(map[int]int)
+		for sub, pid := range m.pages {
+			if !m.pruned(sub) && !m.isTranslation(sub) {
+				m.nsubs[pid]++
+			}
+		}
+	}
+	return m.nsubs[uid]
+}
+
+// hasChildren returns true if uid has a subpage that is not
+// pruned, so that branches and leaves match the tree walked by
+// children.
+func (m *mysql) hasChildren(uid int) bool {
+	return m.childCount(uid) > 0
+}
+
+func (m *mysql) isLeaf(uid int) bool {
+	return !m.hasChildren(uid)
+}
+
+func (m *mysql) directChildren(pid int, pids []int) []int {
+	if pids == nil {
+		pids = make([]int, 0)
+	}
+	start := len(pids)
 	for uid := range m.pages {
-		if m.pages[uid] == pid {
+		if m.pages[uid] == pid && !m.pruned(uid) {
 			pids = append(pids, uid)
-			pids = m.children(uid, pids)
 		}
 	}
+	m.sortSiblings(pids[start:])
 	return pids
 }
 
+// sortSiblings orders uids by their sorting column, then by uid.
+func (m *mysql) sortSiblings(uids []int) {
+	sort.Slice(uids, func(i, j int) bool {
+		si, sj := m.sorting[uids[i]], m.sorting[uids[j]]
+		if si != sj {
+			return si < sj
+		}
+		return uids[i] < uids[j]
+	})
+}
+
+func (m *mysql) all() []int {
+	uids := make([]int, 0, len(m.pages))
+	for uid := range m.pages {
+		uids = append(uids, uid)
+	}
+	sort.Ints(uids)
+	return uids
+}
+
+// root returns the site root of pid, or zero if the chain of
+// ancestors is broken or loops. Results are cached for pid and
+// all ancestors walked.
 func (m *mysql) root(pid int) int {
-	if m.isRoot(pid) {
-		return pid
+	if rid, ok := m.rootsOf[pid]; ok {
+		return rid
 	}
-	var ok bool
-	for {
-		pid, ok = m.pages[pid]
+	var (
+		rid   int
+		chain []int
+		seen  = make(map[int]bool)
+	)
+	for uid := pid; ; {
+		if m.isRoot(uid) {
+			rid = uid
+			break
+		}
+		if r, ok := m.rootsOf[uid]; ok {
+			rid = r
+			break
+		}
+		if seen[uid] {
+			m.foundCycle(append(chain[indexInt(chain, uid):], uid))
+			break
+		}
+		seen[uid] = true
+		chain = append(chain, uid)
+		next, ok := m.pages[uid]
 		if !ok {
-			return 0
+			break
+		}
+		uid = next
+	}
+	for _, uid := range chain {
+		m.rootsOf[uid] = rid
+	}
+	return rid
+}
+
+// ancestors returns uid followed by its parents up to the top
+// of the tree, stopping at loops.
+func (m *mysql) ancestors(uid int) []int {
+	chain := []int{uid}
+	for {
+		pid, ok := m.pages[uid]
+		if !ok || pid == 0 {
+			return chain
 		}
-		if m.isRoot(pid) {
-			return pid
+		if i := indexInt(chain, pid); i >= 0 {
+			m.foundCycle(append(chain[i:], pid))
+			return chain
 		}
+		chain = append(chain, pid)
+		uid = pid
 	}
 }
 
+// depth returns the number of levels between uid and its site
+// root, or between uid and the top of the tree if it has no root.
+func (m *mysql) depth(uid int) int {
+	chain := m.ancestors(uid)
+	if i := indexInt(chain, m.root(uid)); i >= 0 {
+		return i
+	}
+	return len(chain) - 1
+}
+
+// breadcrumb returns the titles from the site root of uid down
+// to uid, joined by sep.
+func (m *mysql) breadcrumb(uid int, sep string) string {
+	chain := m.ancestors(uid)
+	if i := indexInt(chain, m.root(uid)); i >= 0 {
+		chain = chain[:i+1]
+	}
+	titles := make([]string, len(chain))
+	for i, uid := range chain {
+		titles[len(chain)-1-i] = m.titles[uid]
+	}
+	return strings.Join(titles, sep)
+}
+
+// idPath returns the uids from the top of the tree down to uid,
+// as /1/17/243.
+func (m *mysql) idPath(uid int) string {
+	chain := m.ancestors(uid)
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return "/" + intsToString(chain, "/")
+}
+
+// noDomainReason explains why uid resolves to no domain. A root
+// without domain, or no root up to the top of the tree as with
+// -root-predicate, is a configuration issue, while a broken or
+// looping chain of parents means the tree itself is corrupt.
+func (m *mysql) noDomainReason(uid int) string {
+	if rid := m.root(uid); rid != 0 {
+		if target, ok := m.redirs[rid]; ok {
+			return fmt.Sprintf("domain of root %d redirects to %s", rid, target)
+		}
+		return fmt.Sprintf("root %d has no domain", rid)
+	}
+	chain := m.ancestors(uid)
+	top := chain[len(chain)-1]
+	pid, ok := m.pages[top]
+	if !ok {
+		if len(chain) == 1 {
+			return "page does not exist"
+		}
+		return fmt.Sprintf("orphan, parent %d of page %d does not exist", top, chain[len(chain)-2])
+	}
+	if pid == 0 {
+		return "no root page above"
+	}
+	return "loop in parent chain"
+}
+
+// domain returns the domain of root pid, or the fallback domain
+// if it has none.
 func (m *mysql) domain(pid int) string {
-	return m.domains[pid]
+	if d := m.domains[pid]; d != "" {
+		return d
+	}
+	if _, ok := m.redirs[pid]; ok {
+		return ""
+	}
+	return m.fallback
+}
+
+// resolve returns the domain and URL of uid. Both are empty
+// if the page has no domain and its URL is not overridden.
+func (m *mysql) resolve(uid int) (string, string) {
+	domain := m.resolveDomain(uid)
+	if u, ok := m.urls[uid]; ok {
+		return domain, u
+	}
+	if domain == "" {
+		return "", ""
+	}
+	return domain, m.url(uid, domain)
+}
+
+// resolveDomain returns the domain of uid as resolve does, without
+// building its URL.
+func (m *mysql) resolveDomain(uid int) string {
+	if u, ok := m.urls[uid]; ok {
+		if pu, err := url.Parse(u); err == nil {
+			return pu.Host
+		}
+		return ""
+	}
+	anchor := uid
+	if m.opts.mounts {
+		anchor, _ = m.mountedPath(uid, make(map[int]bool))
+	}
+	rid := m.root(anchor)
+	if host, ok := m.hosts[rid]; ok {
+		return host
+	}
+	domain := m.domain(rid)
+	if domain == "" {
+		return ""
+	}
+	if _, host, _ := m.siteBase(anchor); host != "" {
+		domain = host
+	}
+	return domain
+}
+
+// url returns the frontend URL of uid on domain, either from
+// its slug or as an index.php?id= link. Translated pages link
+// to their default language page with the L parameter. The scheme
+// and path of the site configuration base are kept, if any; pages
+// of a mounted subtree take them from the site of the mount point.
+func (m *mysql) url(uid int, domain string) string {
+	anchor, slug := uid, m.slugs[uid]
+	if m.opts.mounts {
+		anchor, slug = m.mountedPath(uid, make(map[int]bool))
+	}
+	scheme, _, prefix := m.siteBase(anchor)
+	if scheme == "" {
+		scheme = "https"
+	}
+	if m.opts.slugs {
+		return scheme + "://" + domain + prefix + m.trailingSlash(slug)
+	}
+	var u string
+	if lang := m.langs[uid]; lang != 0 {
+		u = fmt.Sprintf("%s://%s%s/index.php?id=%d&L=%d", scheme, domain, prefix, m.l10nOf[uid], lang)
+	} else {
+		u = fmt.Sprintf("%s://%s%s/index.php?id=%d", scheme, domain, prefix, uid)
+	}
+	if m.pageType != 0 {
+		u += fmt.Sprintf("&type=%d", m.pageType)
+	}
+	return u
+}
+
+// trailingSlash adds or removes the trailing slash of slug as
+// configured. The slug of a root page is always "/".
+func (m *mysql) trailingSlash(slug string) string {
+	switch m.slash {
+	case "add":
+		if !strings.HasSuffix(slug, "/") {
+			slug += "/"
+		}
+	case "remove":
+		if len(slug) > 1 {
+			slug = strings.TrimRight(slug, "/")
+		}
+	}
+	return slug
+}
+
+// exitIfInterrupted terminates the program with exitInterrupted
+// if ctx was cancelled by a signal.
+func exitIfInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		log.Print("interrupted")
+		os.Exit(exitInterrupted)
+	}
+}
+
+// checkSecret warns, or fails if strict, when the file fname
+// holding credentials is readable by anyone.
+func checkSecret(fname string, strict bool) error {
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0004 != 0 {
+		if strict {
+			return fmt.Errorf("%s is world-readable", fname)
+		}
+		log.Printf("warning: %s is world-readable", fname)
+	}
+	return nil
+}
+
+func readDSNFile(fname string, strict bool) (string, error) {
+	if err := checkSecret(fname, strict); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return "", err
+	}
+	dsn := strings.TrimSpace(string(b))
+	if dsn == "" {
+		return "", fmt.Errorf("%s is empty", fname)
+	}
+	return dsn, nil
+}
+
+// parseTime parses a Unix timestamp or an RFC 3339 date.
+func parseTime(s string) (int64, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither a Unix timestamp nor an RFC 3339 date", s)
+	}
+	return t.Unix(), nil
+}
+
+// formatTime formats a Unix timestamp as ISO 8601 in UTC, or
+// returns an empty string for a zero timestamp.
+func formatTime(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+func filterInts(a []int, keep func(int) bool) []int {
+	b := make([]int, 0, len(a))
+	for _, v := range a {
+		if keep(v) {
+			b = append(b, v)
+		}
+	}
+	return b
+}
+
+func stringToInts(s, sep string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b := strings.Split(s, sep)
+	a := make([]int, len(b))
+	for i := range b {
+		v, err := strconv.Atoi(strings.TrimSpace(b[i]))
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func indexInt(a []int, v int) int {
+	for i := range a {
+		if a[i] == v {
+			return i
+		}
+	}
+	return -1
+}
+
+func intSet(a []int) map[int]bool {
+	set := make(map[int]bool, len(a))
+	for _, v := range a {
+		set[v] = true
+	}
+	return set
+}
+
+// writeCounts writes the page counts by a value such as the doktype,
+// in order of value, either one per line after name or as a JSON
+// object.
+func writeCounts(w io.Writer, name string, counts map[int]int, asJSON bool) error {
+	values := make([]int, 0, len(counts))
+	for v := range counts {
+		values = append(values, v)
+	}
+	sort.Ints(values)
+	if asJSON {
+		b, err := marshalJSON(counts)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	for _, v := range values {
+		if _, err := fmt.Fprintf(w, "%s %d: %d\n", name, v, counts[v]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkInts splits a in slices of at most n elements. The slice
+// is returned whole if n is not positive.
+func chunkInts(a []int, n int) [][]int {
+	if n <= 0 || len(a) <= n {
+		return [][]int{a}
+	}
+	chunks := make([][]int, 0, (len(a)+n-1)/n)
+	for len(a) > n {
+		chunks = append(chunks, a[:n])
+		a = a[n:]
+	}
+	return append(chunks, a)
 }
 
 func intsToString(a []int, sep string) string {
@@ -178,74 +1119,809 @@ func intsToString(a []int, sep string) string {
 
 func main() {
 	pid := flag.Int("pid", 0, "Page ID")
-	dsn := flag.String("dsn", "", "Database connection string")
+	var dsns stringsFlag
+	flag.Var(&dsns, "dsn", "Database connection string (repeatable to merge databases)")
+	addedSince := flag.String("added-since-dsn", "", "Only output pages that do not exist in the database of this DSN")
+	dsnFile := flag.String("dsn-file", "", "Read database connection string from file")
+	defaultsFile := flag.String("defaults-file", "", "Read the connection from the [client] section of a MySQL option file, like ~/.my.cnf")
+	strict := flag.Bool("strict", false, "Fail on warnings")
+	showProgress := flag.Bool("progress", false, "Log the number of pages written and the time left every second")
+	verbose := flag.Bool("verbose", false, "Print diagnostics to stderr")
+	printSQL := flag.Bool("print-sql", false, "Print queries to stderr before running them")
 	query := flag.String("query", "", "A select that yield a list of page IDs")
 	nassoc := flag.Int("nfields", 0, "Number of fields selected except page.uid")
 	children := flag.Bool("children", false, "Select children pages")
 	roots := flag.Bool("roots", false, "Select root pages")
-	csv := flag.Bool("csv", false, "Show CSV for pids, for uid IN (...) query")
+	direct := flag.Bool("direct-children", false, "Select direct children pages, ordered by sorting")
+	all := flag.Bool("all", false, "Select all pages")
+	leaves := flag.Bool("leaves-only", false, "Only output pages without children")
+	branches := flag.Bool("branches-only", false, "Only output pages with children")
+	protected := flag.Bool("exclude-protected", false, "Skip access restricted pages (fe_group), and their subpages if extendToSubpages is set")
+	noindex := flag.Bool("exclude-noindex", false, "Skip pages excluded from search engines (no_search, no_index)")
+	cursorFile := flag.String("cursor-file", "", "Only output pages modified since the previous run with this file, and store the latest tstamp of the output on success")
+	since := flag.String("since", "", "Only output pages modified since a Unix timestamp or RFC 3339 date")
+	exclude := flag.String("exclude", "", "Comma-separated page IDs of subtrees to skip")
+	excludeNavHidden := flag.Bool("exclude-nav-hidden", false, "Skip pages hidden in menus (nav_hide), but not their subpages")
+	navOrder := flag.Bool("nav-order", false, "Select the subpages in menu order: depth-first by sorting, without pages hidden in menus (nav_hide) and their subpages")
+	skipFolders := flag.Bool("exclude-folder-subtrees", false, "Skip folders (doktype 254) and all their subpages")
+	excludeFile := flag.String("exclude-file", "", "Read page IDs of subtrees to skip from file, one per line")
+	onlyRoots := flag.String("only-roots", "", "Comma-separated root page IDs; skip pages under other roots")
+	domainFilter := flag.String("domain-filter", "", "Only output pages whose domain matches, exact or glob (*.example.com)")
+	slugs := flag.Bool("slug", false, "Build URLs from pages.slug (TYPO3 9+)")
+	move := flag.String("simulate-move", "", "Print old and new URLs of the subtree moved by uid=newpid, then exit")
+	affected := flag.String("affected-urls", "", "Print the new URLs of the pages of the subtree moved by uid=newpid whose URL changes, then exit")
+	redirects := flag.Bool("redirects", false, "With -simulate-move, print 'old_url new_url 301' redirect rules")
+	templateRoots := flag.Bool("template-roots", false, "Treat pages with a root sys_template as site roots")
+	overrides := make(uidMap)
+	flag.Var(overrides, "url-override", "Use URL for a page, as uid=url (repeatable)")
+	canonical := make(uidMap)
+	flag.Var(canonical, "canonical-map", "Use host for the URLs of the pages of a root, as rootuid=host, instead of its domain (repeatable)")
+	overridesFile := flag.String("url-override-file", "", "Read uid=url overrides from file, one per line")
+	resolveMounts := flag.Bool("resolve-mounts", false, "Build slug URLs of mounted pages below their mount point")
+	noSiteroot := flag.Bool("no-siteroot-column", false, "Do not read pages.is_siteroot, only pages with pid 0 are roots")
+	rootPredicate := flag.String("root-predicate", "", "SQL expression over pages columns marking site roots, e.g. 'is_siteroot=1 OR pid=0'")
+	subtreeBatch := flag.Int("subtree-batch", 0, "Load only the -pid subtree and its ancestors level by level, with at most N parent pids per query, without recursive SQL")
+	subtreeSQL := flag.Bool("subtree-sql", false, "Load only the -pid subtree and its ancestors with recursive SQL (MySQL 8+), or only the ancestors if no subpages are needed")
+	sites := flag.String("site-config", "", "Directory of TYPO3 site configurations to resolve domains from")
+	names := flag.String("field-names", "", "Comma-separated names of the fields selected by -query")
+	withRoot := flag.Bool("with-root", false, "Include the root page ID in the output")
+	withTstamp := flag.Bool("with-tstamp", false, "Include the last modification time in the output")
+	dumpAssoc := flag.Bool("dump-assoc", false, "Log the uid and the fields of each -query row as scanned, for debugging -nfields")
+	raw := flag.Bool("raw", false, "Output uids and associated fields without resolving URLs")
+	breadcrumb := flag.Bool("breadcrumb", false, "Include the titles from the site root down to each page in the output")
+	crumbSep := flag.String("breadcrumb-separator", " > ", "Separator of the -breadcrumb titles")
+	rollup := flag.Bool("rollup-counts", false, "Include the number of output pages below each page in the tree and yaml formats")
+	withChilds := flag.Bool("with-child-count", false, "Include the number of direct children in the output")
+	header := flag.Bool("header", false, "Write a header line in plain and tsv formats")
+	format := flag.String("format", "", "Output format: "+strings.Join(formats, ", "))
+	shellArray := flag.String("shell-array", "", "With -format shell, print a NAME=(...) array assignment")
+	splitDomain := flag.Bool("split-by-domain", false, "Write the pages of each domain to their own file, see -out-pattern")
+	sitemapIndex := flag.String("sitemap-index", "", "Output a sitemap index with a sitemap URL per domain or file, this pattern with {domain} and {n} replaced as in -out-pattern; the sitemaps are written with -out-pattern")
+	outPattern := flag.String("out-pattern", "", "File name of -split-by-domain output, {domain} is replaced by the domain; with the sitemap format, {n} is replaced by the file number")
+	sitemapMax := flag.Int("sitemap-max", 50000, "Maximum number of URLs per sitemap file, starting a new file if -out-pattern contains {n}")
+	check := flag.Bool("check", false, "Send a HEAD request to each URL and print its status code")
+	checkConcurrency := flag.Int("check-concurrency", 4, "Number of concurrent -check requests")
+	checkTimeout := flag.Duration("check-timeout", 10*time.Second, "Timeout of each -check request")
+	checkFollow := flag.Bool("check-follow-redirects", false, "Follow redirects in -check instead of reporting them")
+	pipeTo := flag.String("pipe-to", "", "Feed records as NDJSON to the standard input of this shell command, failing if it fails")
+	postURL := flag.String("post-url", "", "POST records as NDJSON to URL instead of writing them to stdout")
+	postAuth := flag.String("post-auth-header", "", "Authorization header sent with -post-url, e.g. 'Bearer <token>'")
+	postBatch := flag.Int("post-batch", 500, "Number of records per -post-url request")
+	retries := flag.Int("retries", 3, "Number of retries of failed requests")
+	overlays := flag.Bool("legacy-overlay", false, "Load translations from pages_language_overlay, as negative uids (before TYPO3 9)")
+	hreflang := flag.Bool("hreflang", false, "Print per default language page a JSON set of its translation URLs")
+	followRedirects := flag.Bool("follow-domain-redirects", false, "Use the redirectTo target of redirecting domains instead of skipping their pages")
+	pageType := flag.Int("page-type", 0, "Add type=N to index.php?id= URLs, for sites rendered with a non-default page type")
+	slash := flag.String("trailing-slash", "keep", "Trailing slash of slug URLs: add, remove or keep")
+	redactDomains := flag.Bool("redact-domains", false, "Replace domains in the output with site1, site2..., logging the mapping")
+	requireDomains := flag.Bool("require-domains", false, "Fail if no domain is found, instead of skipping all pages for having no domain")
+	hiddenDomains := flag.Bool("include-disabled-domains", false, "Also use disabled (hidden) sys_domain records, for auditing")
+	defaultDomain := flag.String("default-domain", "", "Domain of pages whose root has no domain")
+	warnDomain := flag.Bool("warn-missing-domain", false, "Warn about pages skipped because they have no domain")
+	language := flag.Int("language", -1, "Only output pages in language N (sys_language_uid), honoring pages.l18n_cfg")
+	pathIndex := flag.Bool("path-index", false, "Output the URL path, uid and domain of the selected pages, tab separated, logging paths shared by several pages")
+	slugAudit := flag.Bool("slug-audit", false, "Report selected pages with an empty slug or the same slug as another page of their site and language")
+	depthHistogram := flag.Bool("depth-histogram", false, "Print the number of selected pages at each depth below their root, as JSON with -format json")
+	doktypeStats := flag.Bool("doktype-stats", false, "Print the number of selected pages per doktype, as JSON with -format json")
+	preserveOrder := flag.Bool("preserve-order", false, "Output the pages of -query in the order of its rows, failing on options that reorder them")
+	uidCol := flag.Int("uid-column", 0, "Position of the uid among the -query columns, starting at 0")
+	onlyDoktype := flag.Int("only-doktype", 0, "Only output pages of doktype N, e.g. 3 for external URLs")
+	sortKey := flag.String("sort", "", "Sort the output by "+strings.Join(sortKeys, ", ")+"; url-length puts the longest URLs first")
+	order := flag.String("order", "", "Order of -children subpages: bfs (level by level) or dfs, both by sorting")
+	minDepth := flag.Int("min-depth", 0, "Only output pages at least N levels below their root")
+	maxDepthWarn := flag.Int("max-depth-warn", 0, "Warn about pages deeper than N levels below their root")
+	failOnCycle := flag.Bool("fail-on-cycle", false, "Exit with an error if the page tree contains a loop")
+	sqliteOut := flag.String("sqlite-out", "", "Write the loaded pages and domains to a new SQLite database and exit")
+	repl := flag.Bool("repl", false, "Load the tree and answer commands read from stdin")
+	bench := flag.Bool("benchmark", false, "Time tree traversals on a synthetic tree and exit")
+	benchPages := flag.Int("bench-pages", 10000, "Number of pages of the -benchmark tree")
+	benchDepth := flag.Int("bench-depth", 5, "Depth of the -benchmark tree")
+	diagnostics := flag.Bool("diagnostics", false, "Print the server version, the tables and columns found and their row counts, and exit")
+	explain := flag.Bool("explain", false, "Print the fields of an output record and exit")
+	esIndex := flag.String("es-index", "", "Index name of the actions of the es-bulk format")
+	csvNull := flag.String("csv-null", "empty", "NULL associated fields in the plain format: empty (\"\"), omit (nothing between commas) or a sentinel written as is, like \\N")
+	separator := flag.String("separator", ", ", "Separator of the uids in the csv format")
+	wrapParens := flag.Bool("wrap-parens", false, "Wrap the uids of the csv format in parentheses, as (1,2,3)")
+	values := flag.Bool("values", false, "Write the uids of the csv format as SQL VALUES rows, as VALUES (1), (2), (3)")
+	chunk := flag.Int("chunk", 0, "Split the uids of the csv format in lines of at most N uids")
+	csv := flag.Bool("csv", false, "Show CSV for pids, for uid IN (...) query (deprecated, use -format csv)")
 	flag.Parse()
-	if *dsn == "" {
-		log.Fatal("must have DSN as argument")
+	if *csv {
+		if *format != "" && *format != "csv" {
+			log.Fatal("cannot use -csv with -format")
+		}
+		log.Print("warning: -csv is deprecated, use -format csv")
+		*format = "csv"
+	}
+	if *postURL != "" {
+		if *format != "" && *format != "ndjson" {
+			log.Fatal("-post-url only supports the ndjson format")
+		}
+		if *postBatch < 1 {
+			log.Fatal("-post-batch must be positive")
+		}
+		*format = "ndjson"
+	}
+	if *pipeTo != "" {
+		if *format != "" && *format != "ndjson" {
+			log.Fatal("-pipe-to only supports the ndjson format")
+		}
+		if *postURL != "" || *check || *splitDomain || *outPattern != "" || *sitemapIndex != "" {
+			log.Fatal("-pipe-to cannot be used with -post-url, -check, -out-pattern or -sitemap-index")
+		}
+		*format = "ndjson"
+	}
+	if *format == "" {
+		*format = "plain"
+	}
+	if *chunk < 0 {
+		log.Fatal("-chunk cannot be negative")
+	}
+	if *values && *wrapParens {
+		log.Fatal("cannot use -values with -wrap-parens")
+	}
+	if *pageType < 0 {
+		log.Fatal("-page-type cannot be negative")
+	}
+	switch *slash {
+	case "add", "remove", "keep":
+	default:
+		log.Fatalf("invalid -trailing-slash %q, must be add, remove or keep", *slash)
+	}
+	if *check {
+		if *format != "plain" || *postURL != "" || *splitDomain || *raw || *hreflang {
+			log.Fatal("-check cannot be used with -format, -post-url, -split-by-domain, -raw or -hreflang")
+		}
+		if *checkConcurrency < 1 {
+			log.Fatal("-check-concurrency must be positive")
+		}
+	}
+	numbered := strings.Contains(*outPattern, "{n}")
+	if *splitDomain {
+		if !strings.Contains(*outPattern, "{domain}") {
+			log.Fatal("-split-by-domain requires an -out-pattern containing {domain}")
+		}
+		if *postURL != "" || *raw || *hreflang {
+			log.Fatal("-split-by-domain cannot be used with -post-url, -raw or -hreflang")
+		}
+		switch *format {
+		case "csv", "shell", "id-path":
+			log.Fatalf("-split-by-domain does not support the %s format", *format)
+		}
+	} else if *outPattern != "" && !numbered {
+		log.Fatal("-out-pattern requires -split-by-domain or {n}")
+	}
+	if numbered {
+		if *format != "sitemap" || *postURL != "" || *check || *hreflang {
+			log.Fatal("{n} in -out-pattern requires the sitemap format and cannot be used with -post-url, -check or -hreflang")
+		}
+		if *sitemapMax < 1 {
+			log.Fatal("-sitemap-max must be positive")
+		}
 	}
-	m, err := newMysql(*dsn)
+	if !validFormat(*format) {
+		log.Fatalf("unknown format %q", *format)
+	}
+	if *sitemapIndex != "" {
+		if (*outPattern == "" || *splitDomain) && !strings.Contains(*sitemapIndex, "{domain}") {
+			log.Fatal("-sitemap-index must contain {domain}")
+		}
+		if numbered && !strings.Contains(*sitemapIndex, "{n}") {
+			log.Fatal("-sitemap-index must contain {n} if -out-pattern does")
+		}
+		if *format != "sitemap" || *postURL != "" || *check {
+			log.Fatal("-sitemap-index requires the sitemap format and cannot be used with -post-url or -check")
+		}
+	}
+	var fnames []string
+	if *names != "" {
+		fnames = strings.Split(*names, ",")
+		if len(fnames) != *nassoc {
+			log.Fatalf("-field-names has %d names, but -nfields is %d", len(fnames), *nassoc)
+		}
+	}
+	rootIDs, err := stringToInts(*onlyRoots, ",")
 	if err != nil {
-		log.Fatalf("mysql error: %v", err)
+		log.Fatalf("invalid -only-roots: %v", err)
+	}
+	excludeIDs, err := stringToInts(*exclude, ",")
+	if err != nil {
+		log.Fatalf("invalid -exclude: %v", err)
+	}
+	if *excludeFile != "" {
+		err := readLines(*excludeFile, func(line string) error {
+			uid, err := strconv.Atoi(line)
+			if err != nil {
+				return err
+			}
+			excludeIDs = append(excludeIDs, uid)
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("cannot read excluded pages: %v", err)
+		}
+	}
+	if *overridesFile != "" {
+		if err := readLines(*overridesFile, overrides.Set); err != nil {
+			log.Fatalf("cannot read URL overrides: %v", err)
+		}
 	}
-	var uids []int
-	if *pid > 0 {
-		if *children {
-			uids = m.children(*pid, nil)
+	sel := &selection{
+		pid:      *pid,
+		query:    *query,
+		nassoc:   *nassoc,
+		uidCol:   *uidCol,
+		children: *children,
+		roots:    *roots,
+		direct:   *direct,
+		all:      *all,
+		leaves:   *leaves,
+		branches: *branches,
+		noindex:  *noindex,
+		minDepth: *minDepth,
+		doktype:  *onlyDoktype,
+		order:    *order,
+		lang:     *language,
+		rootIDs:  intSet(rootIDs),
+		domain:   *domainFilter,
+		navHide:  *excludeNavHidden,
+	}
+	if sel.order != "" && sel.order != "bfs" && sel.order != "dfs" {
+		log.Fatalf("invalid -order %q, must be bfs or dfs", sel.order)
+	}
+	if *preserveOrder {
+		if sel.query == "" {
+			log.Fatal("-preserve-order requires -query")
+		}
+		if sel.expands() || sel.all || sel.order != "" || *sortKey != "" || *navOrder || *check || *pathIndex || *slugAudit {
+			log.Fatal("-preserve-order cannot be used with -children, -direct-children, -roots, -all, -order, -sort, -nav-order, -check, -path-index or -slug-audit")
+		}
+		switch *format {
+		case "tree", "dot", "yaml":
+			log.Fatalf("-preserve-order cannot be used with the %s format, which sorts pages", *format)
 		}
-		if *roots {
-			uids = append(uids, m.root(*pid))
+	}
+	if *navOrder {
+		if sel.order != "" || *sortKey != "" || sel.all {
+			log.Fatal("-nav-order cannot be used with -order, -sort or -all")
+		}
+		sel.children = true
+		sel.order = "dfs"
+	}
+	if *sortKey != "" && !validSortKey(*sortKey) {
+		log.Fatalf("unknown sort key %q", *sortKey)
+	}
+	if *sortKey != "" && sel.order != "" {
+		log.Fatal("-sort cannot be used with -order")
+	}
+	if *subtreeSQL && (sel.pid <= 0 || sel.query != "" || sel.all || *move != "" || *affected != "" || *sqliteOut != "") {
+		log.Fatal("-subtree-sql requires -pid and cannot be used with -query, -all, -simulate-move, -affected-urls or -sqlite-out")
+	}
+	if *subtreeBatch < 0 {
+		log.Fatal("-subtree-batch cannot be negative")
+	}
+	if *subtreeBatch > 0 {
+		if *subtreeSQL {
+			log.Fatal("cannot use -subtree-batch with -subtree-sql")
 		}
-		if !*children && !*roots {
-			uids = append(uids, *pid)
+		if sel.pid <= 0 || sel.query != "" || sel.all || *move != "" || *affected != "" || *sqliteOut != "" {
+			log.Fatal("-subtree-batch requires -pid and cannot be used with -query, -all, -simulate-move, -affected-urls or -sqlite-out")
 		}
 	}
-	if *query != "" {
-		qids, err := m.query(*query, *nassoc)
+	if *doktypeStats && ((*format != "plain" && *format != "json") || *hreflang) {
+		log.Fatal("-doktype-stats only supports the plain and json formats")
+	}
+	if *depthHistogram && ((*format != "plain" && *format != "json") || *hreflang) {
+		log.Fatal("-depth-histogram only supports the plain and json formats")
+	}
+	if *redactDomains && *check {
+		log.Fatal("-redact-domains cannot be used with -check")
+	}
+	if *esIndex != "" && *format != "es-bulk" {
+		log.Fatal("-es-index requires the es-bulk format")
+	}
+	if *rollup && *format != "tree" && *format != "yaml" {
+		log.Fatal("-rollup-counts requires the tree or yaml format")
+	}
+	if *slugAudit && !*slugs {
+		log.Fatal("-slug-audit requires -slug")
+	}
+	if *pathIndex && !*slugs {
+		log.Fatal("-path-index requires -slug")
+	}
+	if *overlays && *slugs {
+		log.Fatal("-legacy-overlay cannot be used with -slug, overlays have no slug")
+	}
+	if *resolveMounts && !*slugs {
+		log.Fatal("-resolve-mounts requires -slug")
+	}
+	if *noSiteroot && *rootPredicate != "" {
+		log.Fatal("cannot use -no-siteroot-column with -root-predicate")
+	}
+	if *rootPredicate != "" {
+		if err := checkRootPredicate(*rootPredicate); err != nil {
+			log.Fatalf("invalid -root-predicate: %v", err)
+		}
+	}
+	if *dumpAssoc && sel.query == "" {
+		log.Fatal("-dump-assoc requires -query")
+	}
+	if sel.uidCol < 0 || sel.uidCol > sel.nassoc {
+		log.Fatalf("-uid-column must be between 0 and -nfields (%d)", sel.nassoc)
+	}
+	if sel.minDepth < 0 {
+		log.Fatal("-min-depth cannot be negative")
+	}
+	if _, err := path.Match(sel.domain, ""); err != nil {
+		log.Fatalf("invalid -domain-filter: %v", err)
+	}
+	if *since != "" {
+		if sel.since, err = parseTime(*since); err != nil {
+			log.Fatalf("invalid -since: %v", err)
+		}
+	}
+	var cur *cursor
+	if *cursorFile != "" {
+		if cur, err = readCursor(*cursorFile); err != nil {
+			log.Fatalf("cannot read cursor file: %v", err)
+		}
+		if cur.ts > sel.since {
+			sel.since = cur.ts
+		}
+	}
+	if *redirects && *move == "" {
+		log.Fatal("-redirects requires -simulate-move")
+	}
+	if *affected != "" && *move != "" {
+		log.Fatal("-affected-urls cannot be used with -simulate-move")
+	}
+	if *shellArray != "" && !shellName.MatchString(*shellArray) {
+		log.Fatalf("invalid -shell-array variable name %q", *shellArray)
+	}
+	if *leaves && *branches {
+		log.Fatal("cannot use -leaves-only and -branches-only together")
+	}
+	ocfg := &outputConfig{
+		format:     *format,
+		fieldNames: fieldNames(fnames, *nassoc),
+		header:     *header,
+		withSource: len(dsns) > 1,
+		withRoot:   *withRoot,
+		withTstamp: *withTstamp,
+		withChilds: *withChilds,
+		raw:        *raw,
+		csvNull:    *csvNull,
+		rollup:     *rollup,
+		esIndex:    *esIndex,
+		sitemapMax: *sitemapMax,
+	}
+	if *format == "json-doc" {
+		ocfg.run = &runInfo{flags: setFlags(*redactDomains)}
+	}
+	if *breadcrumb {
+		if *crumbSep == "" {
+			log.Fatal("-breadcrumb-separator cannot be empty")
+		}
+		ocfg.breadcrumb = *crumbSep
+	}
+	if *raw {
+		switch *format {
+		case "plain", "tsv", "json", "ndjson", "json-doc":
+		default:
+			log.Fatalf("-raw does not support the %s format", *format)
+		}
+		if *withRoot || *withTstamp || *withChilds || *breadcrumb {
+			log.Fatal("-raw cannot be used with -with-root, -with-tstamp, -with-child-count or -breadcrumb")
+		}
+	}
+	if *bench {
+		if *benchPages < 1 || *benchDepth < 1 {
+			log.Fatal("-bench-pages and -bench-depth must be positive")
+		}
+		benchmark(os.Stdout, *benchPages, *benchDepth)
+		return
+	}
+	if *explain {
+		b, err := marshalJSON(ocfg.schema())
 		if err != nil {
-			log.Fatalf("cannot execute argument query: %v", err)
+			log.Fatal(err)
+		}
+		fmt.Printf("%s\n", b)
+		return
+	}
+	if *dsnFile != "" {
+		if len(dsns) > 0 {
+			log.Fatal("cannot use -dsn and -dsn-file together")
+		}
+		dsn, err := readDSNFile(*dsnFile, *strict)
+		if err != nil {
+			log.Fatalf("cannot read DSN file: %v", err)
+		}
+		dsns = append(dsns, dsn)
+	}
+	if *defaultsFile != "" && len(dsns) == 0 {
+		if err := checkSecret(*defaultsFile, *strict); err != nil {
+			log.Fatalf("cannot read defaults file: %v", err)
+		}
+		dsn, err := readDefaultsFile(*defaultsFile)
+		if err != nil {
+			log.Fatalf("cannot read defaults file: %v", err)
+		}
+		dsns = append(dsns, dsn)
+	}
+	if len(dsns) == 0 {
+		log.Fatal("must have DSN as argument")
+	}
+	if len(dsns) > 1 && (*move != "" || *affected != "" || *format == "tree" || *format == "dot" || *format == "yaml" || *format == "json-doc" || *sqliteOut != "") {
+		log.Fatal("-simulate-move, -affected-urls, -sqlite-out and the tree, dot, yaml and json-doc formats need a single -dsn")
+	}
+	if len(dsns) > 1 && (len(overrides) > 0 || *exclude != "" || *onlyRoots != "" || len(canonical) > 0) {
+		// uids are only unique within a database
+		log.Fatal("-url-override, -exclude, -only-roots and -canonical-map need a single -dsn")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *diagnostics {
+		for _, dsn := range dsns {
+			if err := diagnose(ctx, os.Stdout, dsn, *printSQL); err != nil {
+				exitIfInterrupted(ctx)
+				log.Fatalf("cannot run diagnostics: %v", err)
+			}
+		}
+		return
+	}
+	var subtreeRoot int
+	if *subtreeSQL || *subtreeBatch > 0 {
+		subtreeRoot = sel.pid
+	}
+	var redact *redactor
+	if *redactDomains {
+		redact = newRedactor()
+	}
+	sources := make([]*mysql, 0, len(dsns))
+	for _, dsn := range dsns {
+		m, err := newMysql(ctx, dsn, loadOptions{
+			slugs:         *slugs,
+			templateRoots: *templateRoots,
+			protected:     *protected,
+			languages:     *hreflang,
+			printSQL:      *printSQL,
+			titles:        *format == "dot" || *breadcrumb || *sqliteOut != "",
+			noindex:       *noindex,
+			tstamps:       sel.since > 0 || *cursorFile != "" || *withTstamp || *format == "sitemap" || *sqliteOut != "",
+			redirects:     *followRedirects,
+			doktypes:      sel.doktype != 0 || *sqliteOut != "" || *doktypeStats || *resolveMounts || *skipFolders,
+			mounts:        *resolveMounts,
+			skipFolders:   *skipFolders,
+			navHide:       *navOrder || sel.navHide,
+			overlays:      *overlays,
+			noSiteroot:    *noSiteroot,
+			hiddenDomains: *hiddenDomains,
+			pageLangs:     (*sites != "" && *slugs) || *sqliteOut != "" || sel.lang >= 0 || *slugAudit,
+			l18nCfg:       sel.lang >= 0,
+			rootPredicate: *rootPredicate,
+			subtree:       subtreeRoot,
+			batch:         *subtreeBatch,
+			ancestors:     !sel.children && !*direct && !*leaves && !*branches && !*withChilds && !*rollup,
+			siblings:      *withChilds && sel.roots,
+		})
+		if err != nil {
+			for _, m := range sources {
+				m.close()
+			}
+			exitIfInterrupted(ctx)
+			log.Fatalf("mysql error: %v", err)
+		}
+		defer m.close()
+		m.source = dsnName(dsn)
+		if *sites != "" {
+			if err := m.loadSiteConfigs(*sites); err != nil {
+				log.Fatalf("cannot load site configuration: %v", err)
+			}
+		}
+		if *requireDomains && len(m.domains) == 0 {
+			log.Fatalf("%s: no domains found in sys_domain or the site configurations", m.source)
 		}
-		if *children {
-			for _, qid := range qids {
-				uids = m.children(qid, uids)
+		for _, uid := range excludeIDs {
+			m.exclude[uid] = true
+		}
+		if *navOrder {
+			// menus do not show the subpages of hidden pages
+			for uid := range m.navHide {
+				m.exclude[uid] = true
 			}
 		}
-		if *roots {
-			for _, qid := range qids {
-				uids = append(uids, m.root(qid))
+		m.urls = overrides
+		m.hosts = make(uidMap)
+		for rid, host := range canonical {
+			if !m.isRoot(rid) {
+				log.Printf("warning: -canonical-map: page %d is not a site root", rid)
 			}
+			m.hosts[rid] = normalizeHost(host)
+		}
+		m.fallback = normalizeHost(*defaultDomain)
+		m.slash = *slash
+		m.redactor = redact
+		m.dump = *dumpAssoc
+		m.pageType = *pageType
+		if *verbose {
+			log.Printf("%s: loaded %d pages, %d domains, %d roots", m.source, len(m.pages), len(m.domains), len(m.roots))
+		}
+		sources = append(sources, m)
+	}
+	if *sqliteOut != "" {
+		if err := sources[0].writeSQLite(ctx, *sqliteOut); err != nil {
+			log.Fatalf("cannot write SQLite database: %v", err)
 		}
-		if !*children && !*roots {
-			uids = qids
+		return
+	}
+	if *repl {
+		if err := sources[0].repl(os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("cannot read commands: %v", err)
 		}
+		return
 	}
-	if len(uids) == 0 {
+	if *move != "" || *affected != "" {
+		m := sources[0]
+		spec, name := *move, "-simulate-move"
+		if *affected != "" {
+			spec, name = *affected, "-affected-urls"
+		}
+		uid, newpid, err := parseMove(spec)
+		if err != nil {
+			log.Fatalf("invalid %s: %v", name, err)
+		}
+		moves, err := m.simulateMove(uid, newpid)
+		if err != nil {
+			log.Fatalf("cannot simulate move: %v", err)
+		}
+		for _, mv := range moves {
+			if *affected != "" {
+				fmt.Printf("%s\n", mv.to)
+			} else if *redirects {
+				fmt.Printf("%s %s 301\n", mv.from, mv.to)
+			} else {
+				fmt.Printf("%s %s\n", mv.from, mv.to)
+			}
+		}
+		return
+	}
+	var before *mysql
+	if *addedSince != "" {
+		before, err = newMysql(ctx, *addedSince, loadOptions{printSQL: *printSQL})
+		if err != nil {
+			exitIfInterrupted(ctx)
+			log.Fatalf("cannot load comparison database: %v", err)
+		}
+		before.close()
+	}
+	uids := make([][]int, len(sources))
+	var total int
+	for i, m := range sources {
+		uids[i], err = sel.uids(ctx, m)
+		if err != nil {
+			m.close()
+			exitIfInterrupted(ctx)
+			log.Fatalf("cannot execute argument query: %v", err)
+		}
+		if before != nil {
+			uids[i] = filterInts(uids[i], func(uid int) bool {
+				_, ok := before.pages[uid]
+				return !ok
+			})
+		}
+		if cur != nil {
+			uids[i] = cur.unseen(m, uids[i])
+		}
+		if *sortKey != "" {
+			sortUIDs(m, uids[i], *sortKey)
+		}
+		total += len(uids[i])
+	}
+	if total == 0 && cur != nil {
+		log.Print("no pages changed since the cursor")
+		return
+	}
+	if total == 0 {
 		log.Fatal("no UIDs found")
 	}
-	if *csv {
-		fmt.Printf("%s\n", intsToString(uids, ", "))
-	} else {
-		fields := make([]string, *nassoc+1)
-		for _, uid := range uids {
-			rid := m.root(uid)
-			domain := m.domain(rid)
-			if domain == "" {
+	if cur != nil {
+		// Deferred calls do not run on log.Fatal, so the cursor
+		// only moves forward when the whole output was written.
+		next := cur.advance(sources, uids)
+		defer func() {
+			if err := writeCursor(*cursorFile, next); err != nil {
+				log.Fatalf("cannot write cursor file: %v", err)
+			}
+		}()
+	}
+	if *maxDepthWarn > 0 {
+		for i, m := range sources {
+			for _, uid := range uids[i] {
+				if d := m.depth(uid); d > *maxDepthWarn {
+					log.Printf("warning: page %d at depth %d: %s", uid, d, m.idPath(uid))
+				}
+			}
+		}
+	}
+	if *failOnCycle {
+		for i, m := range sources {
+			for _, uid := range uids[i] {
+				m.root(uid)
+			}
+			if m.cycle != nil {
+				log.Fatalf("%s: cycle in page tree: %s", m.source, intsToString(m.cycle, " -> "))
+			}
+		}
+	}
+	if *hreflang {
+		for i, m := range sources {
+			if err := m.writeHreflang(os.Stdout, uids[i]); err != nil {
+				log.Fatalf("cannot write output: %v", err)
+			}
+		}
+		return
+	}
+	if *format == "csv" {
+		for i := range sources {
+			page := pageUIDs(uids[i])
+			if len(page) == 0 {
 				continue
 			}
-			if *nassoc > 0 {
-				assoc := m.assoc[uid]
-				fields[0] = fmt.Sprintf("\"https://%s/index.php?id=%d\"", domain, uid)
-				for i := range assoc {
-					fields[i+1] = fmt.Sprintf("\"%s\"", strings.Replace(assoc[i], "\"", "\\\"", -1))
+			for _, chunk := range chunkInts(page, *chunk) {
+				list := intsToString(chunk, *separator)
+				if *wrapParens {
+					list = "(" + list + ")"
 				}
-				fmt.Printf("%s\n", strings.Join(fields, ","))
-			} else {
-				fmt.Printf("https://%s/index.php?id=%d\n", domain, uid)
+				if *values {
+					list = "VALUES (" + intsToString(chunk, ")"+*separator+"(") + ")"
+				}
+				fmt.Printf("%s\n", list)
 			}
 		}
+		return
+	}
+	if *format == "shell" {
+		var all []int
+		for i := range sources {
+			all = append(all, pageUIDs(uids[i])...)
+		}
+		if *shellArray != "" {
+			fmt.Printf("%s=(%s)\n", *shellArray, intsToString(all, " "))
+		} else {
+			fmt.Printf("%s\n", intsToString(all, " "))
+		}
+		return
+	}
+	if *pathIndex {
+		var collisions int
+		for i, m := range sources {
+			n, err := m.writePathIndex(os.Stdout, uids[i])
+			if err != nil {
+				log.Fatalf("cannot write output: %v", err)
+			}
+			collisions += n
+		}
+		if collisions > 0 {
+			log.Printf("warning: %d paths are used by more than one page", collisions)
+		}
+		return
+	}
+	if *slugAudit {
+		var problems int
+		for i, m := range sources {
+			n, err := m.slugAudit(os.Stdout, uids[i])
+			if err != nil {
+				log.Fatalf("cannot write output: %v", err)
+			}
+			problems += n
+		}
+		if problems > 0 {
+			log.Fatalf("%d slug problems found", problems)
+		}
+		return
+	}
+	if *depthHistogram {
+		counts := make(map[int]int)
+		var deepest int
+		for i, m := range sources {
+			for _, uid := range uids[i] {
+				d := m.depth(uid)
+				counts[d]++
+				if d > deepest {
+					deepest = d
+				}
+			}
+		}
+		// empty levels are listed too, to read as a histogram
+		for d := 0; d < deepest; d++ {
+			if _, ok := counts[d]; !ok {
+				counts[d] = 0
+			}
+		}
+		if err := writeCounts(os.Stdout, "depth", counts, *format == "json"); err != nil {
+			log.Fatalf("cannot write output: %v", err)
+		}
+		return
+	}
+	if *doktypeStats {
+		counts := make(map[int]int)
+		for i, m := range sources {
+			for _, uid := range uids[i] {
+				counts[m.doktypes[uid]]++
+			}
+		}
+		if err := writeCounts(os.Stdout, "doktype", counts, *format == "json"); err != nil {
+			log.Fatalf("cannot write output: %v", err)
+		}
+		return
+	}
+	if *format == "id-path" {
+		for i, m := range sources {
+			for _, uid := range uids[i] {
+				fmt.Printf("%s\n", m.idPath(uid))
+			}
+		}
+		return
+	}
+	var w recordWriter
+	if *postURL != "" {
+		w = newPostWriter(ctx, *postURL, *postAuth, *postBatch, *retries)
+	} else if *pipeTo != "" {
+		if w, err = newPipeWriter(ctx, *pipeTo); err != nil {
+			log.Fatal(err)
+		}
+	} else if *check {
+		w = newCheckWriter(ctx, os.Stdout, *checkConcurrency, *checkTimeout, *checkFollow)
+	} else if *sitemapIndex != "" {
+		var next recordWriter
+		if *outPattern != "" {
+			next = newSplitWriter(ocfg, sources[0], *outPattern, *sitemapMax)
+		}
+		w = newSitemapIndexWriter(os.Stdout, *sitemapIndex, next)
+	} else if *outPattern != "" {
+		w = newSplitWriter(ocfg, sources[0], *outPattern, *sitemapMax)
+	} else {
+		w, err = newRecordWriter(ocfg, os.Stdout, sources[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var prog *progress
+	if *showProgress {
+		prog = newProgress(total, time.Second)
+	}
+	for i, m := range sources {
+		for _, uid := range uids[i] {
+			prog.step()
+			if ctx.Err() != nil {
+				if !abortOutput(w) {
+					w.close()
+				}
+				for _, m := range sources {
+					m.close()
+				}
+				exitIfInterrupted(ctx)
+			}
+			r := m.record(uid, ocfg)
+			if r == nil {
+				if *warnDomain {
+					log.Printf("warning: skipping page %d: %s", uid, m.noDomainReason(uid))
+				}
+				continue
+			}
+			if err := w.write(r); err != nil {
+				abortOutput(w)
+				log.Fatalf("cannot write output: %v", err)
+			}
+		}
+	}
+	// Most of the work of some writers is done on close, so an
+	// interrupt there exits as one too.
+	if err := w.close(); err != nil {
+		exitIfInterrupted(ctx)
+		log.Fatalf("cannot write output: %v", err)
 	}
+	exitIfInterrupted(ctx)
+	prog.done()
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestAddPageRoots(t *testing.T) {
+	null := sql.NullInt64{}
+	no := sql.NullInt64{Int64: 0, Valid: true}
+	yes := sql.NullInt64{Int64: 1, Valid: true}
+	tests := []struct {
+		name      string
+		predicate string
+		rows      []pageRow
+		roots     []int
+	}{
+		{
+			name: "is_siteroot",
+			rows: []pageRow{
+				{uid: 1, pid: 0, isroot: null},
+				{uid: 2, pid: 1, isroot: null},
+				{uid: 3, pid: 1, isroot: no},
+				{uid: 4, pid: 1, isroot: yes},
+				{uid: 5, pid: 0, isroot: no},
+			},
+			roots: []int{1, 4, 5},
+		},
+		{
+			name:      "root predicate",
+			predicate: "doktype=1",
+			rows: []pageRow{
+				{uid: 1, pid: 0, isroot: null},
+				{uid: 2, pid: 0, isroot: no},
+				{uid: 3, pid: 1, isroot: yes},
+			},
+			roots: []int{3},
+		},
+		{
+			name: "duplicate row",
+			rows: []pageRow{
+				{uid: 1, pid: 0, isroot: yes},
+				{uid: 1, pid: 0, isroot: yes},
+			},
+			roots: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mysql{
+				opts:    loadOptions{rootPredicate: tt.predicate},
+				pages:   make(map[int]int),
+				sorting: make(map[int]int),
+			}
+			for i := range tt.rows {
+				m.addPage(&tt.rows[i])
+			}
+			if !reflect.DeepEqual(m.roots, tt.roots) {
+				t.Errorf("roots = %v, want %v", m.roots, tt.roots)
+			}
+		})
+	}
+}
+
+func TestHasChildrenPruned(t *testing.T) {
+	m := &mysql{
+		pages:   map[int]int{1: 0, 2: 1, 3: 2, 4: 1, 5: 4, 6: 5},
+		exclude: map[int]bool{3: true},
+		locked:  map[int]bool{6: true},
+		extends: map[int]bool{6: true},
+	}
+	for uid, want := range map[int]bool{1: true, 2: false, 3: false, 4: true, 5: false, 6: false} {
+		if got := m.hasChildren(uid); got != want {
+			t.Errorf("hasChildren(%d) = %v, want %v", uid, got, want)
+		}
+	}
+}
+
+func TestNoDomainReason(t *testing.T) {
+	m := &mysql{
+		opts:    loadOptions{rootPredicate: "doktype=1"},
+		pages:   map[int]int{1: 0, 2: 1, 3: 9, 4: 5, 5: 4, 6: 0},
+		rootsOf: make(map[int]int),
+		roots:   []int{6},
+	}
+	for uid, want := range map[int]string{
+		2: "no root page above",
+		3: "orphan, parent 9 of page 3 does not exist",
+		4: "loop in parent chain",
+		6: "root 6 has no domain",
+		7: "page does not exist",
+	} {
+		if got := m.noDomainReason(uid); got != want {
+			t.Errorf("noDomainReason(%d) = %q, want %q", uid, got, want)
+		}
+	}
+}
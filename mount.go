@@ -0,0 +1,35 @@
+package main
+
+import "strings"
+
+// addMount records that the page mountPid is mounted at the mount
+// point uid. If a page is mounted more than once, the mount point
+// with the lowest uid is used, so that URLs are stable.
+func (m *mysql) addMount(uid, mountPid int) {
+	if mp, ok := m.mounts[mountPid]; ok && mp < uid {
+		return
+	}
+	m.mounts[mountPid] = uid
+}
+
+// mountedPath returns the page whose site root the URL of uid is
+// on, and the slug of uid below its closest mounted ancestor. The
+// slug is the path of the mount point followed by the path of uid
+// below the mounted page, and mount points can be mounted in turn.
+// seen holds the mount points followed, to stop at recursive mounts.
+func (m *mysql) mountedPath(uid int, seen map[int]bool) (int, string) {
+	for _, a := range m.ancestors(uid) {
+		mp, ok := m.mounts[a]
+		if !ok || seen[mp] {
+			continue
+		}
+		seen[mp] = true
+		anchor, prefix := m.mountedPath(mp, seen)
+		if a == uid {
+			return anchor, prefix
+		}
+		rel := strings.TrimPrefix(m.slugs[uid], strings.TrimSuffix(m.slugs[a], "/"))
+		return anchor, strings.TrimSuffix(prefix, "/") + rel
+	}
+	return uid, m.slugs[uid]
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// urlMove is the change of URL of a page after a move.
+type urlMove struct {
+	uid      int
+	from, to string
+}
+
+// parseMove parses a uid=newpid move specification.
+func parseMove(s string) (int, int, error) {
+	a, b, ok := strings.Cut(s, "=")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not in the form uid=newpid", s)
+	}
+	uid, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil {
+		return 0, 0, err
+	}
+	newpid, err := strconv.Atoi(strings.TrimSpace(b))
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, newpid, nil
+}
+
+func copyInts(a map[int]int) map[int]int {
+	b := make(map[int]int, len(a))
+	for k, v := range a {
+		b[k] = v
+	}
+	return b
+}
+
+// moved returns a copy of m where uid, whose subtree is given, has
+// been moved below newpid. Slugs of the subtree are rewritten the
+// way TYPO3 does when moving pages: the last segment of the page is
+// kept and prefixed by the slug of the new parent.
+func (m *mysql) moved(uid, newpid int, subtree []int) *mysql {
+	c := *m
+	c.pages = copyInts(m.pages)
+	c.pages[uid] = newpid
+	c.rootsOf = make(map[int]int)
+	c.nsubs = nil
+	if !m.opts.slugs {
+		return &c
+	}
+	c.slugs = make(map[int]string, len(m.slugs))
+	for k, v := range m.slugs {
+		c.slugs[k] = v
+	}
+	var prefix string
+	if newpid != 0 && !m.isRoot(newpid) {
+		prefix = strings.TrimSuffix(m.slugs[newpid], "/")
+	}
+	old := m.slugs[uid]
+	slug := prefix + "/" + path.Base(old)
+	c.slugs[uid] = slug
+	for _, sub := range subtree {
+		if s := m.slugs[sub]; sub != uid && strings.HasPrefix(s, old+"/") {
+			c.slugs[sub] = slug + strings.TrimPrefix(s, old)
+		}
+	}
+	return &c
+}
+
+// simulateMove returns the URLs that change when uid is moved
+// below newpid. Pages without a domain before or after the move
+// are not reported.
+func (m *mysql) simulateMove(uid, newpid int) ([]urlMove, error) {
+	if _, ok := m.pages[uid]; !ok {
+		return nil, fmt.Errorf("page %d not found", uid)
+	}
+	if _, ok := m.pages[newpid]; !ok && newpid != 0 {
+		return nil, fmt.Errorf("page %d not found", newpid)
+	}
+	subtree := m.children(uid, []int{uid})
+	for _, sub := range subtree {
+		if sub == newpid {
+			return nil, fmt.Errorf("cannot move page %d below its own subpage %d", uid, newpid)
+		}
+	}
+	c := m.moved(uid, newpid, subtree)
+	moves := make([]urlMove, 0)
+	for _, sub := range subtree {
+		_, from := m.publicURL(sub)
+		_, to := c.publicURL(sub)
+		if from == "" || to == "" {
+			continue
+		}
+		mv := urlMove{uid: sub, from: from, to: to}
+		if mv.from != mv.to {
+			moves = append(moves, mv)
+		}
+	}
+	return moves, nil
+}
@@ -0,0 +1,896 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formats lists the accepted values of the -format flag.
+var formats = []string{"plain", "csv", "tsv", "json", "ndjson", "sitemap", "tree", "dot", "id-path", "shell", "kv", "yaml", "es-bulk", "json-doc"}
+
+func validFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// record is a resolved page ready for output.
+type record struct {
+	UID    int      `json:"uid"`
+	Domain string   `json:"domain,omitempty"`
+	URL    string   `json:"url,omitempty"`
+	Source string   `json:"source,omitempty"`
+	Root   *int     `json:"root,omitempty"`
+	Tstamp string   `json:"tstamp,omitempty"` // last modification, ISO 8601 in UTC
+	Childs *int     `json:"child_count,omitempty"`
+	Crumbs string   `json:"breadcrumb,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	nulls  []bool   // fields that are NULL, nil if none
+}
+
+// outputConfig holds the options shared by all record writers.
+type outputConfig struct {
+	format     string
+	fieldNames []string // names of the associated fields
+	header     bool     // write a header line in tabular formats
+	withSource bool     // include the source database
+	withRoot   bool     // include the root uid
+	withTstamp bool     // include the last modification time
+	withChilds bool     // include the number of direct children
+	raw        bool     // only uid and associated fields, without URL
+	breadcrumb string   // separator of the titles breadcrumb, if included
+	csvNull    string   // NULL fields in the plain format: empty, omit or a sentinel
+	rollup     bool     // include the number of output pages below each node of nested formats
+	esIndex    string   // index of the es-bulk actions, if set
+	sitemapMax int      // URLs per sitemap file
+	run        *runInfo // provenance written by the json-doc format
+}
+
+// columns describes the columns of tabular formats: the URL, the
+// computed columns and the associated fields.
+func (cfg *outputConfig) columns() []schemaField {
+	if cfg.raw {
+		cols := []schemaField{{Name: "uid", Type: "integer"}}
+		for _, name := range cfg.fieldNames {
+			cols = append(cols, schemaField{Name: name, Type: "string"})
+		}
+		return cols
+	}
+	cols := []schemaField{{Name: "url", Type: "string"}}
+	if cfg.withSource {
+		cols = append(cols, schemaField{Name: "source", Type: "string"})
+	}
+	if cfg.withRoot {
+		cols = append(cols, schemaField{Name: "root", Type: "integer"})
+	}
+	if cfg.withTstamp {
+		cols = append(cols, schemaField{Name: "tstamp", Type: "string"})
+	}
+	if cfg.withChilds {
+		cols = append(cols, schemaField{Name: "child_count", Type: "integer"})
+	}
+	if cfg.breadcrumb != "" {
+		cols = append(cols, schemaField{Name: "breadcrumb", Type: "string"})
+	}
+	for _, name := range cfg.fieldNames {
+		cols = append(cols, schemaField{Name: name, Type: "string"})
+	}
+	return cols
+}
+
+// row returns the values of r in the order of columns.
+func (cfg *outputConfig) row(r *record) []string {
+	if cfg.raw {
+		return append([]string{strconv.Itoa(r.UID)}, r.Fields...)
+	}
+	row := []string{r.URL}
+	if cfg.withSource {
+		row = append(row, r.Source)
+	}
+	if cfg.withRoot {
+		row = append(row, strconv.Itoa(*r.Root))
+	}
+	if cfg.withTstamp {
+		row = append(row, r.Tstamp)
+	}
+	if cfg.withChilds {
+		row = append(row, strconv.Itoa(*r.Childs))
+	}
+	if cfg.breadcrumb != "" {
+		row = append(row, r.Crumbs)
+	}
+	return append(row, r.Fields...)
+}
+
+// fieldNames returns names for n associated fields, using
+// names where given and field0, field1... otherwise.
+func fieldNames(names []string, n int) []string {
+	b := make([]string, n)
+	for i := range b {
+		if i < len(names) {
+			b[i] = names[i]
+		} else {
+			b[i] = fmt.Sprintf("field%d", i)
+		}
+	}
+	return b
+}
+
+// schemaField describes a field of an output record.
+type schemaField struct {
+	Name  string        `json:"name"`
+	Type  string        `json:"type"`
+	Items []schemaField `json:"items,omitempty"`
+}
+
+// schema describes the records written with the configuration.
+type schema struct {
+	Format string        `json:"format"`
+	Header bool          `json:"header,omitempty"`
+	Fields []schemaField `json:"fields"`
+}
+
+func (cfg *outputConfig) schema() *schema {
+	s := &schema{Format: cfg.format}
+	assoc := make([]schemaField, len(cfg.fieldNames))
+	for i := range cfg.fieldNames {
+		assoc[i] = schemaField{Name: cfg.fieldNames[i], Type: "string"}
+	}
+	switch cfg.format {
+	case "csv", "shell":
+		s.Fields = []schemaField{{Name: "uid", Type: "integer"}}
+	case "id-path":
+		s.Fields = []schemaField{{Name: "path", Type: "string"}}
+	case "json", "ndjson", "es-bulk", "json-doc":
+		if cfg.raw {
+			s.Fields = []schemaField{{Name: "uid", Type: "integer"}}
+			if len(assoc) > 0 {
+				s.Fields = append(s.Fields, schemaField{Name: "fields", Type: "array", Items: assoc})
+			}
+			break
+		}
+		s.Fields = []schemaField{
+			{Name: "uid", Type: "integer"},
+			{Name: "domain", Type: "string"},
+			{Name: "url", Type: "string"},
+		}
+		if cfg.withSource {
+			s.Fields = append(s.Fields, schemaField{Name: "source", Type: "string"})
+		}
+		if cfg.withRoot {
+			s.Fields = append(s.Fields, schemaField{Name: "root", Type: "integer"})
+		}
+		if cfg.withTstamp {
+			s.Fields = append(s.Fields, schemaField{Name: "tstamp", Type: "string"})
+		}
+		if cfg.withChilds {
+			s.Fields = append(s.Fields, schemaField{Name: "child_count", Type: "integer"})
+		}
+		if cfg.breadcrumb != "" {
+			s.Fields = append(s.Fields, schemaField{Name: "breadcrumb", Type: "string"})
+		}
+		if len(assoc) > 0 {
+			s.Fields = append(s.Fields, schemaField{Name: "fields", Type: "array", Items: assoc})
+		}
+	case "sitemap":
+		s.Fields = []schemaField{{Name: "loc", Type: "string"}, {Name: "lastmod", Type: "string"}}
+	case "tree":
+		s.Fields = []schemaField{{Name: "url", Type: "string"}}
+	case "yaml":
+		s.Fields = []schemaField{
+			{Name: "uid", Type: "integer"},
+			{Name: "domain", Type: "string"},
+			{Name: "url", Type: "string"},
+		}
+		if cfg.rollup {
+			s.Fields = append(s.Fields, schemaField{Name: "subtree_count", Type: "integer"})
+		}
+		s.Fields = append(s.Fields, schemaField{Name: "children", Type: "array"})
+	case "dot":
+		s.Fields = []schemaField{{Name: "uid", Type: "integer"}, {Name: "title", Type: "string"}}
+	case "kv":
+		s.Fields = []schemaField{
+			{Name: "uid", Type: "integer"},
+			{Name: "root", Type: "integer"},
+			{Name: "domain", Type: "string"},
+		}
+		for _, col := range cfg.columns() {
+			if col.Name != "root" {
+				s.Fields = append(s.Fields, col)
+			}
+		}
+	default:
+		s.Fields = cfg.columns()
+		s.Header = cfg.header && (cfg.format == "tsv" || len(s.Fields) > 1)
+	}
+	return s
+}
+
+// record returns the output record of uid, or nil if the
+// page has no URL.
+func (m *mysql) record(uid int, cfg *outputConfig) *record {
+	if cfg.raw {
+		r := &record{UID: uid, Fields: make([]string, len(cfg.fieldNames)), nulls: m.nulls[uid]}
+		copy(r.Fields, m.assoc[uid])
+		return r
+	}
+	domain, u := m.publicURL(uid)
+	if u == "" {
+		return nil
+	}
+	r := &record{
+		UID:    uid,
+		Domain: domain,
+		URL:    u,
+	}
+	if cfg.withSource {
+		r.Source = m.source
+	}
+	if cfg.withRoot || cfg.format == "kv" {
+		rid := m.root(uid)
+		r.Root = &rid
+	}
+	if cfg.withTstamp || cfg.format == "sitemap" {
+		r.Tstamp = formatTime(m.tstamps[uid])
+	}
+	if cfg.withChilds {
+		n := m.childCount(uid)
+		r.Childs = &n
+	}
+	if cfg.breadcrumb != "" {
+		r.Crumbs = m.breadcrumb(uid, cfg.breadcrumb)
+	}
+	if n := len(cfg.fieldNames); n > 0 {
+		r.Fields = make([]string, n)
+		copy(r.Fields, m.assoc[uid])
+		r.nulls = m.nulls[uid]
+	}
+	return r
+}
+
+type recordWriter interface {
+	write(r *record) error
+	// close terminates the output and flushes it.
+	close() error
+}
+
+// aborter is implemented by writers to files, to remove them instead
+// of terminating them when the output is interrupted or fails.
+type aborter interface {
+	abort()
+}
+
+// abortOutput removes the files written by w and returns true, if w
+// is an aborter.
+func abortOutput(w recordWriter) bool {
+	a, ok := w.(aborter)
+	if ok {
+		a.abort()
+	}
+	return ok
+}
+
+// newRecordWriter returns a writer for format. The csv, shell and
+// id-path formats only need uids and are not handled by record writers.
+func newRecordWriter(cfg *outputConfig, w io.Writer, m *mysql) (recordWriter, error) {
+	bw := bufio.NewWriter(w)
+	switch cfg.format {
+	case "plain":
+		if cols := cfg.columns(); cfg.header && len(cols) > 1 {
+			writeHeader(bw, cols, ",", quote)
+		}
+		return &plainWriter{w: bw, cfg: cfg}, nil
+	case "tsv":
+		if cfg.header {
+			writeHeader(bw, cfg.columns(), "\t", escapeTSV)
+		}
+		return &tsvWriter{w: bw, cfg: cfg}, nil
+	case "json":
+		return &jsonWriter{w: bw}, nil
+	case "json-doc":
+		return newJSONDocWriter(bw, m.source, cfg.run)
+	case "ndjson":
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		return &ndjsonWriter{w: bw, enc: enc}, nil
+	case "es-bulk":
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		return &esBulkWriter{ndjsonWriter: ndjsonWriter{w: bw, enc: enc}, index: cfg.esIndex}, nil
+	case "sitemap":
+		return newSitemapWriter(bw, cfg.sitemapMax), nil
+	case "tree":
+		return &treeWriter{collector: newCollector(m), w: bw, rollup: cfg.rollup}, nil
+	case "yaml":
+		return &yamlWriter{collector: newCollector(m), w: bw, rollup: cfg.rollup}, nil
+	case "kv":
+		return &kvWriter{w: bw, cfg: cfg}, nil
+	case "dot":
+		return &dotWriter{collector: newCollector(m), w: bw}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", cfg.format)
+}
+
+func writeHeader(w *bufio.Writer, cols []schemaField, sep string, escape func(string) string) {
+	names := make([]string, len(cols))
+	for i := range cols {
+		names[i] = escape(cols[i].Name)
+	}
+	fmt.Fprintf(w, "%s\n", strings.Join(names, sep))
+}
+
+func writeRow(w *bufio.Writer, row []string, sep string, escape func(string) string) error {
+	for i := range row {
+		row[i] = escape(row[i])
+	}
+	_, err := fmt.Fprintf(w, "%s\n", strings.Join(row, sep))
+	return err
+}
+
+// marshalJSON is json.Marshal without escaping of HTML characters,
+// which are common in URLs.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
+
+func quote(s string) string {
+	return fmt.Sprintf("\"%s\"", strings.Replace(s, "\"", "\\\"", -1))
+}
+
+// plainWriter writes one URL per line, or a quoted comma-separated
+// line of URL and associated fields.
+type plainWriter struct {
+	w   *bufio.Writer
+	cfg *outputConfig
+}
+
+func (p *plainWriter) write(r *record) error {
+	row := p.cfg.row(r)
+	if len(row) == 1 {
+		_, err := fmt.Fprintf(p.w, "%s\n", row[0])
+		return err
+	}
+	if r.nulls == nil || p.cfg.csvNull == "empty" {
+		return writeRow(p.w, row, ",", quote)
+	}
+	var null string
+	if p.cfg.csvNull != "omit" {
+		null = p.cfg.csvNull
+	}
+	off := len(row) - len(r.Fields)
+	for i := range row {
+		if i >= off && r.nulls[i-off] {
+			row[i] = null
+		} else {
+			row[i] = quote(row[i])
+		}
+	}
+	_, err := fmt.Fprintf(p.w, "%s\n", strings.Join(row, ","))
+	return err
+}
+
+func (p *plainWriter) close() error {
+	return p.w.Flush()
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// escapeTSV escapes backslashes, tabs and line breaks in s
+// as \\, \t, \n and \r respectively.
+func escapeTSV(s string) string {
+	return tsvEscaper.Replace(s)
+}
+
+// tsvWriter writes the URL and associated fields separated by tabs.
+type tsvWriter struct {
+	w   *bufio.Writer
+	cfg *outputConfig
+}
+
+func (t *tsvWriter) write(r *record) error {
+	return writeRow(t.w, t.cfg.row(r), "\t", escapeTSV)
+}
+
+func (t *tsvWriter) close() error {
+	return t.w.Flush()
+}
+
+// kvQuote quotes s if it would be ambiguous in a key=value list.
+func kvQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// kvWriter writes one line of space-separated key=value pairs per record.
+type kvWriter struct {
+	w   *bufio.Writer
+	cfg *outputConfig
+}
+
+func (k *kvWriter) write(r *record) error {
+	fmt.Fprintf(k.w, "uid=%d root=%d domain=%s", r.UID, *r.Root, kvQuote(r.Domain))
+	row := k.cfg.row(r)
+	for i, col := range k.cfg.columns() {
+		if col.Name != "root" {
+			fmt.Fprintf(k.w, " %s=%s", col.Name, kvQuote(row[i]))
+		}
+	}
+	_, err := k.w.WriteString("\n")
+	return err
+}
+
+func (k *kvWriter) close() error {
+	return k.w.Flush()
+}
+
+// jsonWriter writes all records as a single JSON array.
+type jsonWriter struct {
+	w *bufio.Writer
+	n int
+}
+
+func (j *jsonWriter) write(r *record) error {
+	b, err := marshalJSON(r)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if j.n == 0 {
+		sep = "[\n"
+	}
+	j.n++
+	if _, err := j.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonWriter) close() error {
+	end := "\n]\n"
+	if j.n == 0 {
+		end = "[]\n"
+	}
+	if _, err := j.w.WriteString(end); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// jsonDocWriter writes a single JSON object with the records in
+// pages, after the time, database and flags of the run, and their
+// count at the end. Records are streamed as with jsonWriter.
+type jsonDocWriter struct {
+	jsonWriter
+}
+
+// runInfo describes the run that generated a json-doc document.
+type runInfo struct {
+	flags map[string]string // flags set on the command line
+}
+
+func newJSONDocWriter(w *bufio.Writer, database string, run *runInfo) (*jsonDocWriter, error) {
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"generated_at", time.Now().UTC().Format(time.RFC3339)},
+		{"database", database},
+		{"flags", run.flags},
+	}
+	w.WriteString("{")
+	for _, f := range fields {
+		b, err := marshalJSON(f.value)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(w, "\n\"%s\": %s,", f.name, b)
+	}
+	w.WriteString("\n\"pages\": ")
+	return &jsonDocWriter{jsonWriter{w: w}}, nil
+}
+
+func (j *jsonDocWriter) close() error {
+	end := "\n],\n"
+	if j.n == 0 {
+		end = "[],\n"
+	}
+	if _, err := fmt.Fprintf(j.w, "%s\"count\": %d\n}\n", end, j.n); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// ndjsonWriter writes one JSON object per line.
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) write(r *record) error {
+	return n.enc.Encode(r)
+}
+
+func (n *ndjsonWriter) close() error {
+	return n.w.Flush()
+}
+
+// esAction is the action line of an Elasticsearch bulk request.
+type esAction struct {
+	Index struct {
+		Index string `json:"_index,omitempty"`
+		ID    string `json:"_id"`
+	} `json:"index"`
+}
+
+// esBulkWriter writes records as the body of an Elasticsearch _bulk
+// request: an index action with the uid as document id, followed by
+// the record as document.
+type esBulkWriter struct {
+	ndjsonWriter
+	index string
+}
+
+func (e *esBulkWriter) write(r *record) error {
+	var a esAction
+	a.Index.Index = e.index
+	a.Index.ID = strconv.Itoa(r.UID)
+	if err := e.enc.Encode(&a); err != nil {
+		return err
+	}
+	return e.enc.Encode(r)
+}
+
+// sitemapWriter writes an XML sitemap as per sitemaps.org. Sitemaps
+// of more than limit URLs are warned about, as search engines reject
+// them.
+type sitemapWriter struct {
+	w     *bufio.Writer
+	n     int
+	limit int
+}
+
+func newSitemapWriter(w *bufio.Writer, limit int) *sitemapWriter {
+	w.WriteString(xml.Header + "<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n")
+	return &sitemapWriter{w: w, limit: limit}
+}
+
+func (s *sitemapWriter) write(r *record) error {
+	s.n++
+	s.w.WriteString("  <url><loc>")
+	if err := xml.EscapeText(s.w, []byte(r.URL)); err != nil {
+		return err
+	}
+	s.w.WriteString("</loc>")
+	if r.Tstamp != "" {
+		fmt.Fprintf(s.w, "<lastmod>%s</lastmod>", r.Tstamp)
+	}
+	_, err := s.w.WriteString("</url>\n")
+	return err
+}
+
+func (s *sitemapWriter) close() error {
+	if s.limit > 0 && s.n > s.limit {
+		log.Printf("warning: sitemap of %d URLs, more than %d; split it with {n} in -out-pattern", s.n, s.limit)
+	}
+	if _, err := s.w.WriteString("</urlset>\n"); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// sitemapIndexWriter writes a sitemap index as per sitemaps.org.
+// Records are passed on to next, if set, to write the sitemaps
+// themselves: the index lists the files of next if it splits them,
+// else a sitemap for each domain, in the order they are first seen.
+// Sitemap URLs are built from pattern as the file names by partName,
+// and their lastmod is the latest of their records.
+type sitemapIndexWriter struct {
+	w       *bufio.Writer
+	pattern string
+	parts   []*splitPart
+	domains map[string]*splitPart
+	next    recordWriter
+}
+
+func newSitemapIndexWriter(w io.Writer, pattern string, next recordWriter) *sitemapIndexWriter {
+	return &sitemapIndexWriter{w: bufio.NewWriter(w), pattern: pattern, domains: make(map[string]*splitPart), next: next}
+}
+
+func (s *sitemapIndexWriter) write(r *record) error {
+	p, ok := s.domains[r.Domain]
+	if !ok {
+		p = &splitPart{domain: r.Domain, n: 1}
+		s.domains[r.Domain] = p
+		s.parts = append(s.parts, p)
+	}
+	p.add(r)
+	if s.next != nil {
+		return s.next.write(r)
+	}
+	return nil
+}
+
+// abort removes the sitemaps written by next, if any, and leaves
+// the index out.
+func (s *sitemapIndexWriter) abort() {
+	if s.next != nil {
+		abortOutput(s.next)
+	}
+}
+
+func (s *sitemapIndexWriter) close() error {
+	parts := s.parts
+	if s.next != nil {
+		if err := s.next.close(); err != nil {
+			return err
+		}
+		if sw, ok := s.next.(*splitWriter); ok {
+			parts = sw.parts
+		}
+	}
+	s.w.WriteString(xml.Header + "<sitemapindex xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n")
+	for _, p := range parts {
+		loc := partName(s.pattern, p)
+		s.w.WriteString("  <sitemap><loc>")
+		if err := xml.EscapeText(s.w, []byte(loc)); err != nil {
+			return err
+		}
+		s.w.WriteString("</loc>")
+		if p.lastmod != "" {
+			fmt.Fprintf(s.w, "<lastmod>%s</lastmod>", p.lastmod)
+		}
+		s.w.WriteString("</sitemap>\n")
+	}
+	if _, err := s.w.WriteString("</sitemapindex>\n"); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// collector keeps the records of formats that need the whole
+// tree before writing.
+type collector struct {
+	m       *mysql
+	records map[int]*record
+}
+
+func newCollector(m *mysql) collector {
+	return collector{m: m, records: make(map[int]*record)}
+}
+
+func (c *collector) write(r *record) error {
+	c.records[r.UID] = r
+	return nil
+}
+
+// parent returns the closest ancestor of uid that has been written,
+// or zero if there is none.
+func (c *collector) parent(uid int) int {
+	for i := 0; i < len(c.m.pages); i++ {
+		pid, ok := c.m.pages[uid]
+		if !ok || pid == 0 {
+			return 0
+		}
+		if _, ok := c.records[pid]; ok {
+			return pid
+		}
+		uid = pid
+	}
+	return 0
+}
+
+// childs returns the written records by closest written parent,
+// ordered as siblings.
+func (c *collector) childs() map[int][]int {
+	childs := make(map[int][]int)
+	for uid := range c.records {
+		pid := c.parent(uid)
+		childs[pid] = append(childs[pid], uid)
+	}
+	for _, uids := range childs {
+		c.m.sortSiblings(uids)
+	}
+	return childs
+}
+
+// subtreeSizes returns the number of written records below each
+// record in childs, as returned by childs. Sizes are added up from
+// the leaves in a single walk of the tree.
+func (c *collector) subtreeSizes(childs map[int][]int) map[int]int {
+	sizes := make(map[int]int)
+	// post-order walk: a page is popped once its subpages are done
+	type frame struct {
+		uid  int
+		done bool
+	}
+	stack := []frame{{uid: 0}}
+	seen := map[int]bool{0: true}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.done {
+			for _, sub := range childs[f.uid] {
+				sizes[f.uid] += 1 + sizes[sub]
+			}
+			continue
+		}
+		stack = append(stack, frame{uid: f.uid, done: true})
+		for _, sub := range childs[f.uid] {
+			if !seen[sub] {
+				seen[sub] = true
+				stack = append(stack, frame{uid: sub})
+			}
+		}
+	}
+	return sizes
+}
+
+// treeWriter writes the URLs indented under their closest
+// ancestor that is also part of the output.
+type treeWriter struct {
+	collector
+	w      *bufio.Writer
+	rollup bool // append the number of written pages below each URL
+}
+
+func (t *treeWriter) close() error {
+	childs := t.childs()
+	var sizes map[int]int
+	if t.rollup {
+		sizes = t.subtreeSizes(childs)
+	}
+	var walk func(pid int, indent string) error
+	walk = func(pid int, indent string) error {
+		for _, uid := range childs[pid] {
+			line := indent + t.records[uid].URL
+			if t.rollup {
+				line += fmt.Sprintf(" (%d)", sizes[uid])
+			}
+			if _, err := fmt.Fprintf(t.w, "%s\n", line); err != nil {
+				return err
+			}
+			if err := walk(uid, indent+"  "); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(0, ""); err != nil {
+		return err
+	}
+	return t.w.Flush()
+}
+
+// yamlNode is a page of the yaml format, with its subpages.
+type yamlNode struct {
+	UID      int         `yaml:"uid"`
+	Domain   string      `yaml:"domain"`
+	URL      string      `yaml:"url"`
+	Subtree  *int        `yaml:"subtree_count,omitempty"`
+	Children []*yamlNode `yaml:"children,omitempty"`
+}
+
+// yamlWriter writes the pages as a YAML list of nested nodes,
+// like the tree format.
+type yamlWriter struct {
+	collector
+	w      *bufio.Writer
+	rollup bool // include the number of written pages below each node
+}
+
+func (y *yamlWriter) close() error {
+	childs := y.childs()
+	var sizes map[int]int
+	if y.rollup {
+		sizes = y.subtreeSizes(childs)
+	}
+	var nodes func(pid int) []*yamlNode
+	nodes = func(pid int) []*yamlNode {
+		var list []*yamlNode
+		for _, uid := range childs[pid] {
+			r := y.records[uid]
+			node := &yamlNode{UID: uid, Domain: r.Domain, URL: r.URL, Children: nodes(uid)}
+			if y.rollup {
+				n := sizes[uid]
+				node.Subtree = &n
+			}
+			list = append(list, node)
+		}
+		return list
+	}
+	enc := yaml.NewEncoder(y.w)
+	enc.SetIndent(2)
+	if err := enc.Encode(nodes(0)); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return y.w.Flush()
+}
+
+var dotEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "")
+
+// dotQuote returns s as a quoted GraphViz DOT string.
+func dotQuote(s string) string {
+	return "\"" + dotEscaper.Replace(s) + "\""
+}
+
+// dotWriter writes a GraphViz DOT graph of the pages, with a
+// cluster per site root and edges from parents to subpages.
+type dotWriter struct {
+	collector
+	w *bufio.Writer
+}
+
+func (d *dotWriter) close() error {
+	clusters := make(map[int][]int)
+	for uid := range d.records {
+		rid := d.m.root(uid)
+		clusters[rid] = append(clusters[rid], uid)
+	}
+	rids := make([]int, 0, len(clusters))
+	for rid := range clusters {
+		rids = append(rids, rid)
+	}
+	sort.Ints(rids)
+	d.w.WriteString("digraph t3tree {\n")
+	for _, rid := range rids {
+		uids := clusters[rid]
+		sort.Ints(uids)
+		label := d.m.publicDomain(rid)
+		if label == "" {
+			label = strconv.Itoa(rid)
+		}
+		fmt.Fprintf(d.w, "  subgraph %s {\n    label=%s;\n", dotQuote(fmt.Sprintf("cluster_%d", rid)), dotQuote(label))
+		for _, uid := range uids {
+			label := strconv.Itoa(uid)
+			if title := d.m.titles[uid]; title != "" {
+				label += "\n" + title
+			}
+			fmt.Fprintf(d.w, "    %d [label=%s];\n", uid, dotQuote(label))
+		}
+		d.w.WriteString("  }\n")
+	}
+	childs := d.childs()
+	pids := make([]int, 0, len(childs))
+	for pid := range childs {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	for _, pid := range pids {
+		if pid == 0 {
+			continue
+		}
+		for _, uid := range childs[pid] {
+			fmt.Fprintf(d.w, "  %d -> %d;\n", pid, uid)
+		}
+	}
+	if _, err := d.w.WriteString("}\n"); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
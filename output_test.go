@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSite returns a tree of pages, as uid : pid, below the root 1
+// on example.com.
+func testSite(pages map[int]int) *mysql {
+	return &mysql{
+		pages:   pages,
+		domains: map[int]string{1: "example.com"},
+		rootsOf: make(map[int]int),
+		roots:   []int{1},
+	}
+}
+
+// writeRecords writes the records of uids in the format of cfg and
+// returns the output.
+func writeRecords(t *testing.T, m *mysql, cfg *outputConfig, uids ...int) string {
+	t.Helper()
+	var b bytes.Buffer
+	w, err := newRecordWriter(cfg, &b, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range uids {
+		if err := w.write(m.record(uid, cfg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestDotClusterLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		redact  bool
+		want    []string
+		notWant []string
+	}{
+		{"canonical", false, []string{`label="www.example.com"`, `label="canonical.example.org"`}, []string{"shop.example.com"}},
+		{"redacted", true, []string{`label="site1"`, `label="site2"`}, []string{"example.com", "example.org"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testSite(map[int]int{1: 0, 2: 1, 3: 0, 4: 3})
+			m.domains = map[int]string{1: "www.example.com", 3: "shop.example.com"}
+			m.hosts = uidMap{3: "canonical.example.org"}
+			m.roots = []int{1, 3}
+			if tt.redact {
+				m.redactor = newRedactor()
+			}
+			out := writeRecords(t, m, &outputConfig{format: "dot"}, 1, 2, 3, 4)
+			for _, s := range tt.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("dot output has no %s:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(out, s) {
+					t.Errorf("dot output contains %s:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestTreeRollupCountsOutput(t *testing.T) {
+	m := testSite(map[int]int{1: 0, 2: 1, 3: 2, 4: 1, 5: 2})
+	out := writeRecords(t, m, &outputConfig{format: "tree", rollup: true}, 1, 2, 3)
+	want := "https://example.com/index.php?id=1 (2)\n" +
+		"  https://example.com/index.php?id=2 (1)\n" +
+		"    https://example.com/index.php?id=3 (0)\n"
+	if out != want {
+		t.Errorf("tree output =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestChildCount(t *testing.T) {
+	// 5 is excluded and 4 is the translation of 3.
+	m := testSite(map[int]int{1: 0, 2: 1, 3: 1, 4: 1, 5: 2, 6: 3})
+	m.exclude = map[int]bool{5: true}
+	m.langs = map[int]int{4: 1}
+	m.l10nOf = map[int]int{4: 3}
+	cfg := &outputConfig{withChilds: true}
+	for uid, want := range map[int]int{1: 2, 2: 0, 3: 1, 6: 0} {
+		if got := *m.record(uid, cfg).Childs; got != want {
+			t.Errorf("child_count of %d = %d, want %d", uid, got, want)
+		}
+	}
+	uids := []int{1, 2, 3, 6}
+	for _, tt := range []struct {
+		sel  selection
+		want []int
+	}{
+		{selection{lang: -1, leaves: true}, []int{2, 6}},
+		{selection{lang: -1, branches: true}, []int{1, 3}},
+	} {
+		got := tt.sel.filter(m, uids)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("leaves %v, branches %v: %v, want %v", tt.sel.leaves, tt.sel.branches, got, tt.want)
+		}
+		for _, uid := range got {
+			if n := *m.record(uid, cfg).Childs; (n > 0) != tt.sel.branches {
+				t.Errorf("page %d selected with child_count %d", uid, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+)
+
+// pathEntry is a line of the -path-index table.
+type pathEntry struct {
+	path   string
+	uid    int
+	domain string
+}
+
+// writePathIndex writes the URL path, uid and domain of the pages
+// in uids, tab separated and sorted by domain and path, skipping
+// pages without a domain. Paths of more than one page on the same
+// domain are logged as collisions, and their number is returned.
+func (m *mysql) writePathIndex(w io.Writer, uids []int) (int, error) {
+	entries := make([]pathEntry, 0, len(uids))
+	for _, uid := range uids {
+		domain, u := m.publicURL(uid)
+		if domain == "" {
+			continue
+		}
+		pu, err := url.Parse(u)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse URL of page %d: %v", uid, err)
+		}
+		entries = append(entries, pathEntry{path: pu.Path, uid: uid, domain: domain})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.domain != b.domain {
+			return a.domain < b.domain
+		}
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		return a.uid < b.uid
+	})
+	var collisions int
+	for i := 0; i < len(entries); {
+		j := i + 1
+		for j < len(entries) && entries[j].domain == entries[i].domain && entries[j].path == entries[i].path {
+			j++
+		}
+		if j-i > 1 {
+			collisions++
+			group := make([]int, 0, j-i)
+			for _, e := range entries[i:j] {
+				group = append(group, e.uid)
+			}
+			log.Printf("warning: path collision %s%s: %s", entries[i].domain, entries[i].path, intsToString(group, " "))
+		}
+		for _, e := range entries[i:j] {
+			if _, err := fmt.Fprintf(w, "%s\t%d\t%s\n", e.path, e.uid, e.domain); err != nil {
+				return collisions, err
+			}
+		}
+		i = j
+	}
+	return collisions, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// pipeWriter feeds records as NDJSON to the standard input of a
+// shell command, whose output goes to stdout.
+type pipeWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	w     *bufio.Writer
+	enc   *json.Encoder
+}
+
+func newPipeWriter(ctx context.Context, command string) (*pipeWriter, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start %q: %v", command, err)
+	}
+	p := &pipeWriter{cmd: cmd, stdin: stdin, w: bufio.NewWriter(stdin)}
+	p.enc = json.NewEncoder(p.w)
+	p.enc.SetEscapeHTML(false)
+	return p, nil
+}
+
+// write fails with the exit status of the command if it stopped
+// reading early, rather than with a broken pipe.
+func (p *pipeWriter) write(r *record) error {
+	if err := p.enc.Encode(r); err != nil {
+		return p.fail(err)
+	}
+	return nil
+}
+
+func (p *pipeWriter) close() error {
+	if err := p.w.Flush(); err != nil {
+		return p.fail(err)
+	}
+	if err := p.stdin.Close(); err != nil {
+		return p.fail(err)
+	}
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("command %q failed: %v", p.cmd.Args[2], err)
+	}
+	return nil
+}
+
+func (p *pipeWriter) fail(err error) error {
+	p.stdin.Close()
+	if werr := p.cmd.Wait(); werr != nil {
+		return fmt.Errorf("command %q failed: %v", p.cmd.Args[2], werr)
+	}
+	return err
+}
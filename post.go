@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// postWriter sends records as NDJSON to an HTTP endpoint,
+// in batches of a fixed number of records.
+type postWriter struct {
+	ctx     context.Context
+	client  *http.Client
+	url     string
+	auth    string // value of the Authorization header
+	batch   int
+	retries int
+	buf     bytes.Buffer
+	enc     *json.Encoder
+	n       int
+}
+
+func newPostWriter(ctx context.Context, url, auth string, batch, retries int) *postWriter {
+	p := &postWriter{
+		ctx:     ctx,
+		client:  &http.Client{Timeout: 60 * time.Second},
+		url:     url,
+		auth:    auth,
+		batch:   batch,
+		retries: retries,
+	}
+	p.enc = json.NewEncoder(&p.buf)
+	p.enc.SetEscapeHTML(false)
+	return p
+}
+
+func (p *postWriter) write(r *record) error {
+	if err := p.enc.Encode(r); err != nil {
+		return err
+	}
+	p.n++
+	if p.n >= p.batch {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *postWriter) close() error {
+	return p.flush()
+}
+
+// flush sends the pending batch, retrying up to p.retries times.
+func (p *postWriter) flush() error {
+	if p.n == 0 {
+		return nil
+	}
+	for i := 0; ; i++ {
+		err := p.post(p.buf.Bytes())
+		if err == nil {
+			break
+		}
+		if i >= p.retries || p.ctx.Err() != nil {
+			return fmt.Errorf("cannot deliver batch of %d records: %v", p.n, err)
+		}
+		log.Printf("warning: cannot deliver batch, retrying: %v", err)
+		select {
+		case <-time.After(time.Duration(i+1) * time.Second):
+		case <-p.ctx.Done():
+		}
+	}
+	p.buf.Reset()
+	p.n = 0
+	return nil
+}
+
+func (p *postWriter) post(body []byte) error {
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if p.auth != "" {
+		req.Header.Set("Authorization", p.auth)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
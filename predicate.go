@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// predicateToken matches the tokens allowed in a root predicate:
+// names, numbers, single quoted strings without escapes, operators
+// and parentheses.
+var predicateToken = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_]*|[0-9]+|'[^'\\]*'|<=|>=|<>|!=|[=<>()+\-*/,]|\s+)`)
+
+// predicateOperators are the words allowed besides column names.
+var predicateOperators = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "XOR": true, "IS": true, "NULL": true,
+	"IN": true, "BETWEEN": true, "LIKE": true, "TRUE": true, "FALSE": true,
+}
+
+// predicateReserved are words that must not appear in a predicate.
+var predicateReserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "UNION": true, "INTO": true,
+	"INSERT": true, "UPDATE": true, "DELETE": true, "DROP": true, "ALTER": true,
+	"CREATE": true, "GRANT": true, "SET": true, "CALL": true, "EXISTS": true,
+}
+
+// checkRootPredicate makes sure expr is a plain boolean expression
+// over columns of pages, as it is put as is in the pages query.
+// Function calls, subqueries, comments, variables and statement
+// separators are refused.
+func checkRootPredicate(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("empty expression")
+	}
+	for _, c := range []string{"--", "/*", "*/"} {
+		if strings.Contains(expr, c) {
+			return fmt.Errorf("comments are not allowed")
+		}
+	}
+	var (
+		depth  int
+		column bool // previous token is a column name
+	)
+	for s := expr; s != ""; {
+		tok := predicateToken.FindString(s)
+		if tok == "" {
+			return fmt.Errorf("unexpected %q", s)
+		}
+		s = s[len(tok):]
+		if strings.TrimSpace(tok) == "" {
+			continue
+		}
+		switch c := tok[0]; {
+		case c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+			word := strings.ToUpper(tok)
+			if predicateReserved[word] {
+				return fmt.Errorf("%s is not allowed", tok)
+			}
+			column = !predicateOperators[word]
+			continue
+		case c == '(':
+			if column {
+				return fmt.Errorf("function calls are not allowed")
+			}
+			depth++
+		case c == ')':
+			if depth--; depth < 0 {
+				return fmt.Errorf("unbalanced parentheses")
+			}
+		}
+		column = false
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses")
+	}
+	return nil
+}
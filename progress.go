@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// progress logs how many of total pages were processed and the
+// estimated time left, at most once per interval.
+type progress struct {
+	total    int
+	n        int
+	start    time.Time
+	last     time.Time
+	interval time.Duration
+}
+
+func newProgress(total int, interval time.Duration) *progress {
+	now := time.Now()
+	return &progress{total: total, start: now, last: now, interval: interval}
+}
+
+// step counts a processed page.
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	p.n++
+	if now := time.Now(); now.Sub(p.last) >= p.interval {
+		p.last = now
+		p.log(now)
+	}
+}
+
+func (p *progress) log(now time.Time) {
+	elapsed := now.Sub(p.start)
+	eta := time.Duration(float64(elapsed) / float64(p.n) * float64(p.total-p.n))
+	log.Printf("progress: %d/%d pages (%d%%), %v left", p.n, p.total, 100*p.n/p.total, eta.Round(time.Second))
+}
+
+// done logs the number of pages processed and the time taken.
+func (p *progress) done() {
+	if p == nil {
+		return
+	}
+	log.Printf("progress: %d pages in %v", p.n, time.Since(p.start).Round(time.Millisecond))
+}
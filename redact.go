@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// redactor replaces domains with site1, site2... in the order they
+// are first output, the same for all databases.
+type redactor struct {
+	names map[string]string
+}
+
+func newRedactor() *redactor {
+	return &redactor{names: make(map[string]string)}
+}
+
+// redact returns domain and u with the domain replaced by its
+// placeholder. New placeholders are logged, so that the mapping
+// is on stderr and not in the output.
+func (r *redactor) redact(domain, u string) (string, string) {
+	if r == nil || domain == "" {
+		return domain, u
+	}
+	name, ok := r.names[domain]
+	if !ok {
+		name = fmt.Sprintf("site%d", len(r.names)+1)
+		r.names[domain] = name
+		log.Printf("redacted %s as %s", domain, name)
+	}
+	return name, strings.Replace(u, "//"+domain, "//"+name, 1)
+}
+
+// publicURL returns the domain and URL of uid as resolve, redacted
+// if -redact-domains is set. Filters use resolve, on real domains.
+func (m *mysql) publicURL(uid int) (string, string) {
+	return m.redactor.redact(m.resolve(uid))
+}
+
+// publicDomain returns the domain of uid as resolveDomain, redacted
+// if -redact-domains is set.
+func (m *mysql) publicDomain(uid int) string {
+	domain, _ := m.redactor.redact(m.resolveDomain(uid), "")
+	return domain
+}
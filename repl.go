@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `commands:
+  children UID   all pages below UID
+  direct UID     direct children of UID
+  root UID       site root of UID
+  domain UID     domain of the site root of UID
+  url UID        URL of UID
+  ancestors UID  parents of UID up to the top of the tree
+  depth UID      levels between UID and its site root
+  quit           leave
+`
+
+// repl reads commands from r and answers them from the loaded tree,
+// so that it can be explored without querying the database again.
+func (m *mysql) repl(r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	fmt.Fprint(w, "> ")
+	for sc.Scan() {
+		args := strings.Fields(sc.Text())
+		if len(args) > 0 {
+			if args[0] == "quit" || args[0] == "exit" {
+				return nil
+			}
+			if err := m.replCommand(w, args); err != nil {
+				fmt.Fprintf(w, "error: %v\n", err)
+			}
+		}
+		fmt.Fprint(w, "> ")
+	}
+	fmt.Fprintln(w)
+	return sc.Err()
+}
+
+func (m *mysql) replCommand(w io.Writer, args []string) error {
+	if args[0] == "help" {
+		fmt.Fprint(w, replHelp)
+		return nil
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s UID, see help", args[0])
+	}
+	uid, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid uid %q", args[1])
+	}
+	switch args[0] {
+	case "children":
+		fmt.Fprintln(w, intsToString(m.children(uid, nil), " "))
+	case "direct":
+		fmt.Fprintln(w, intsToString(m.directChildren(uid, nil), " "))
+	case "root":
+		fmt.Fprintln(w, m.root(uid))
+	case "domain":
+		if d := m.domain(m.root(uid)); d != "" {
+			fmt.Fprintln(w, d)
+		} else {
+			fmt.Fprintf(w, "none: %s\n", m.noDomainReason(uid))
+		}
+	case "url":
+		if _, u := m.resolve(uid); u != "" {
+			fmt.Fprintln(w, u)
+		} else {
+			fmt.Fprintf(w, "none: %s\n", m.noDomainReason(uid))
+		}
+	case "ancestors":
+		fmt.Fprintln(w, intsToString(m.ancestors(uid)[1:], " "))
+	case "depth":
+		fmt.Fprintln(w, m.depth(uid))
+	default:
+		return fmt.Errorf("unknown command %q, see help", args[0])
+	}
+	return nil
+}
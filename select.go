@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+)
+
+// selection holds the flags that choose the pages to output.
+type selection struct {
+	pid      int
+	query    string
+	nassoc   int
+	uidCol   int // position of the uid among the query columns
+	children bool
+	roots    bool
+	direct   bool
+	all      bool
+	leaves   bool
+	branches bool
+	noindex  bool
+	since    int64 // minimum tstamp, if positive
+	minDepth int   // minimum depth below the root, if positive
+	doktype  int   // only doktype, if not zero
+	rootIDs  map[int]bool
+	domain   string // glob pattern the domain must match
+	order    string // bfs or dfs order of children, unordered if empty
+	lang     int    // only pages shown in this language, if not negative
+	navHide  bool   // drop pages hidden in menus, keeping their subpages
+}
+
+// expand appends to uids the pages selected from pid.
+func (sel *selection) expand(m *mysql, pid int, uids []int) []int {
+	if sel.children {
+		if sel.order != "" {
+			uids = m.traverse(pid, uids, sel.order == "bfs")
+		} else {
+			uids = m.children(pid, uids)
+		}
+	}
+	if sel.roots {
+		uids = append(uids, m.root(pid))
+	}
+	if sel.direct {
+		uids = m.directChildren(pid, uids)
+	}
+	return uids
+}
+
+func (sel *selection) expands() bool {
+	return sel.children || sel.roots || sel.direct
+}
+
+// uids returns the selected pages of m, after filtering.
+func (sel *selection) uids(ctx context.Context, m *mysql) ([]int, error) {
+	var uids []int
+	if sel.pid > 0 {
+		if sel.expands() {
+			uids = sel.expand(m, sel.pid, uids)
+		} else {
+			uids = append(uids, sel.pid)
+		}
+	}
+	if sel.query != "" {
+		qids, err := m.query(ctx, sel.query, sel.nassoc, sel.uidCol)
+		if err != nil {
+			return nil, err
+		}
+		if sel.expands() {
+			for _, qid := range qids {
+				uids = sel.expand(m, qid, uids)
+			}
+		} else {
+			uids = qids
+		}
+	}
+	if sel.all {
+		uids = m.all()
+	}
+	return sel.filter(m, uids), nil
+}
+
+// filter drops the pages that are not to be output, keeping the
+// order of uids.
+func (sel *selection) filter(m *mysql, uids []int) []int {
+	// The site filters run first, so that pages of other sites
+	// are dropped before any other lookup.
+	if len(sel.rootIDs) > 0 {
+		uids = filterInts(uids, func(uid int) bool {
+			return sel.rootIDs[m.root(uid)]
+		})
+	}
+	if sel.domain != "" {
+		glob := strings.ToLower(sel.domain)
+		uids = filterInts(uids, func(uid int) bool {
+			ok, _ := path.Match(glob, strings.ToLower(m.resolveDomain(uid)))
+			return ok
+		})
+	}
+	if len(m.exclude) > 0 || len(m.locked) > 0 {
+		uids = filterInts(uids, func(uid int) bool {
+			return !m.excluded(uid)
+		})
+	}
+	if sel.navHide {
+		uids = filterInts(uids, func(uid int) bool {
+			return !m.navHide[uid]
+		})
+	}
+	if sel.since > 0 {
+		uids = filterInts(uids, func(uid int) bool {
+			return m.tstamps[uid] >= sel.since
+		})
+	}
+	if sel.noindex {
+		uids = filterInts(uids, func(uid int) bool {
+			return !m.noindex[uid]
+		})
+	}
+	if sel.lang >= 0 {
+		uids = filterInts(uids, func(uid int) bool {
+			return m.inLanguage(uid, sel.lang)
+		})
+	}
+	if sel.doktype != 0 {
+		uids = filterInts(uids, func(uid int) bool {
+			return m.doktypes[uid] == sel.doktype
+		})
+	}
+	if sel.minDepth > 0 {
+		uids = filterInts(uids, func(uid int) bool {
+			return m.depth(uid) >= sel.minDepth
+		})
+	}
+	if sel.leaves {
+		uids = filterInts(uids, m.isLeaf)
+	}
+	if sel.branches {
+		uids = filterInts(uids, m.hasChildren)
+	}
+	return uids
+}
+
+// sortKeys lists the accepted values of the -sort flag.
+var sortKeys = []string{"uid", "depth", "url-length", "domain"}
+
+func validSortKey(key string) bool {
+	for _, k := range sortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sortUIDs orders uids by key, with ties in uid order. URLs are
+// sorted longest first, to find overly long ones at the top.
+func sortUIDs(m *mysql, uids []int, key string) {
+	var cmp func(a, b int) int
+	switch key {
+	case "depth":
+		cmp = func(a, b int) int { return m.depth(a) - m.depth(b) }
+	case "url-length":
+		cmp = func(a, b int) int {
+			_, ua := m.resolve(a)
+			_, ub := m.resolve(b)
+			return len(ub) - len(ua)
+		}
+	case "domain":
+		cmp = func(a, b int) int {
+			return strings.Compare(m.resolveDomain(a), m.resolveDomain(b))
+		}
+	default:
+		cmp = func(a, b int) int { return 0 }
+	}
+	sort.SliceStable(uids, func(i, j int) bool {
+		if c := cmp(uids[i], uids[j]); c != 0 {
+			return c < 0
+		}
+		return uids[i] < uids[j]
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// siteConfig is the subset of a TYPO3 site configuration
+// (config/sites/<identifier>/config.yaml) used to resolve domains.
+type siteConfig struct {
+	RootPageID int            `yaml:"rootPageId"`
+	Base       string         `yaml:"base"`
+	Languages  []siteLanguage `yaml:"languages"`
+}
+
+// siteLanguage is a language of a site. Its base is either a path
+// prefix like /de/ or a full URL on another domain.
+type siteLanguage struct {
+	LanguageID int    `yaml:"languageId"`
+	Base       string `yaml:"base"`
+	Hreflang   string `yaml:"hreflang"`
+	ISOCode    string `yaml:"iso-639-1"`
+}
+
+// langCode returns the hreflang code of language lang, or its ISO
+// code, or an empty string if the site does not configure either.
+func (sc *siteConfig) langCode(lang int) string {
+	for _, l := range sc.Languages {
+		if l.LanguageID != lang {
+			continue
+		}
+		if l.Hreflang != "" {
+			return l.Hreflang
+		}
+		return l.ISOCode
+	}
+	return ""
+}
+
+func readSiteConfig(fname string) (*siteConfig, error) {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var sc siteConfig
+	if err := yaml.Unmarshal(b, &sc); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", fname, err)
+	}
+	if sc.RootPageID <= 0 {
+		return nil, fmt.Errorf("%s: missing rootPageId", fname)
+	}
+	return &sc, nil
+}
+
+// host returns the host part of the site base, or an empty
+// string if the base is relative.
+func (sc *siteConfig) host() string {
+	u, err := url.Parse(sc.Base)
+	if err != nil {
+		return ""
+	}
+	return normalizeHost(u.Host)
+}
+
+// base returns the scheme, host and path without trailing slash
+// of the base of language lang. A language base without host is a
+// path below the site base, as in TYPO3. Scheme and host are empty
+// if the bases are relative.
+func (sc *siteConfig) base(lang int) (string, string, string) {
+	var scheme, host, path string
+	if u, err := url.Parse(sc.Base); err == nil {
+		scheme, host, path = u.Scheme, normalizeHost(u.Host), strings.TrimRight(u.Path, "/")
+	}
+	for _, l := range sc.Languages {
+		if l.LanguageID != lang {
+			continue
+		}
+		u, err := url.Parse(l.Base)
+		if err != nil {
+			break
+		}
+		if u.Host != "" {
+			return u.Scheme, normalizeHost(u.Host), strings.TrimRight(u.Path, "/")
+		}
+		if p := strings.Trim(u.Path, "/"); p != "" {
+			path += "/" + p
+		}
+		break
+	}
+	return scheme, host, path
+}
+
+// siteBase returns the base of the language of uid in the site
+// configuration of its root, as returned by siteConfig.base.
+// Without slugs, translations are linked with the L parameter
+// on the default language base.
+func (m *mysql) siteBase(uid int) (string, string, string) {
+	sc, ok := m.sites[m.root(uid)]
+	if !ok {
+		return "", "", ""
+	}
+	if !m.opts.slugs {
+		return sc.base(0)
+	}
+	return sc.base(m.langs[uid])
+}
+
+// loadSiteConfigs reads all site configurations found in dir.
+// The rootPageId of each site is treated as a site root and its
+// base takes precedence over any sys_domain record.
+func (m *mysql) loadSiteConfigs(dir string) error {
+	fnames, err := filepath.Glob(filepath.Join(dir, "*", "config.yaml"))
+	if err != nil {
+		return err
+	}
+	if len(fnames) == 0 {
+		return fmt.Errorf("no site configurations found in %s", dir)
+	}
+	for _, fname := range fnames {
+		sc, err := readSiteConfig(fname)
+		if err != nil {
+			return err
+		}
+		m.sites[sc.RootPageID] = sc
+		if !m.isRoot(sc.RootPageID) {
+			m.roots = append(m.roots, sc.RootPageID)
+		}
+		if host := sc.host(); host != "" {
+			m.domains[sc.RootPageID] = host
+		}
+	}
+	return nil
+}
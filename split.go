@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// splitPart is a file written by splitWriter, or a sitemap of a
+// sitemap index.
+type splitPart struct {
+	domain  string
+	n       int    // number of the file of domain, from 1
+	count   int    // records written
+	lastmod string // latest tstamp of the records
+	name    string // file written, if any
+	f       *os.File
+	w       recordWriter
+}
+
+func (p *splitPart) add(r *record) {
+	p.count++
+	if r.Tstamp > p.lastmod {
+		p.lastmod = r.Tstamp
+	}
+}
+
+// close closes the writer and file of p, if still open.
+func (p *splitPart) close() error {
+	if p.f == nil {
+		return nil
+	}
+	err := p.w.close()
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	p.f, p.w = nil, nil
+	return err
+}
+
+// splitWriter writes records to files named after pattern, with
+// {domain} replaced by the domain of the records and {n} by the
+// number of the file. A pattern with {n} starts a new file every
+// perFile records.
+type splitWriter struct {
+	cfg     *outputConfig
+	m       *mysql
+	pattern string
+	perFile int
+	parts   []*splitPart
+	current map[string]*splitPart
+}
+
+func newSplitWriter(cfg *outputConfig, m *mysql, pattern string, perFile int) *splitWriter {
+	if !strings.Contains(pattern, "{n}") {
+		perFile = 0
+	}
+	return &splitWriter{cfg: cfg, m: m, pattern: pattern, perFile: perFile, current: make(map[string]*splitPart)}
+}
+
+// partName returns pattern with {domain} replaced by the safe
+// domain of p and {n} by its number, naming both the file of p and
+// its location in a sitemap index.
+func partName(pattern string, p *splitPart) string {
+	name := strings.ReplaceAll(pattern, "{domain}", safeDomain(p.domain))
+	return strings.ReplaceAll(name, "{n}", strconv.Itoa(p.n))
+}
+
+// safeDomain returns domain keeping only characters that are safe
+// in file names.
+func safeDomain(domain string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, domain)
+	if safe == "" || strings.Trim(safe, ".") == "" {
+		safe = "_"
+	}
+	return safe
+}
+
+func (s *splitWriter) write(r *record) error {
+	var key string
+	if strings.Contains(s.pattern, "{domain}") {
+		key = r.Domain
+	}
+	p, ok := s.current[key]
+	if !ok || (s.perFile > 0 && p.count >= s.perFile) {
+		next := &splitPart{domain: key, n: 1}
+		if ok {
+			if err := p.close(); err != nil {
+				return err
+			}
+			next.n = p.n + 1
+		}
+		next.name = partName(s.pattern, next)
+		f, err := os.Create(next.name)
+		if err != nil {
+			return err
+		}
+		next.f = f
+		s.parts = append(s.parts, next)
+		if next.w, err = newRecordWriter(s.cfg, f, s.m); err != nil {
+			return err
+		}
+		s.current[key] = next
+		p = next
+	}
+	p.add(r)
+	return p.w.write(r)
+}
+
+// close closes all files. If any of them fails, all files are
+// removed, as they would not make up the whole output.
+func (s *splitWriter) close() error {
+	var errs []string
+	for _, p := range s.parts {
+		if err := p.close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		s.abort()
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// abort removes all files written, without terminating them.
+func (s *splitWriter) abort() {
+	for _, p := range s.parts {
+		if p.f != nil {
+			p.f.Close()
+			p.f, p.w = nil, nil
+		}
+		os.Remove(p.name)
+	}
+}
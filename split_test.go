@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartName(t *testing.T) {
+	tests := []struct {
+		pattern string
+		part    splitPart
+		want    string
+	}{
+		{"sitemap-{domain}.xml", splitPart{domain: "www.example.com"}, "sitemap-www.example.com.xml"},
+		{"sitemap-{domain}-{n}.xml", splitPart{domain: "example.com:8080", n: 2}, "sitemap-example.com_8080-2.xml"},
+		{"https://example.com/{domain}/{n}.xml", splitPart{domain: "bücher.de", n: 1}, "https://example.com/b_cher.de/1.xml"},
+		{"{domain}.xml", splitPart{domain: ".."}, "_.xml"},
+	}
+	for _, tt := range tests {
+		if got := partName(tt.pattern, &tt.part); got != tt.want {
+			t.Errorf("partName(%q, %q) = %q, want %q", tt.pattern, tt.part.domain, got, tt.want)
+		}
+	}
+}
+
+func TestSplitWriterAbort(t *testing.T) {
+	m := testSite(map[int]int{1: 0, 2: 1, 3: 1})
+	dir := t.TempDir()
+	cfg := &outputConfig{format: "sitemap"}
+	w := newSplitWriter(cfg, m, filepath.Join(dir, "sitemap-{domain}-{n}.xml"), 2)
+	for uid := 1; uid <= 3; uid++ {
+		if err := w.write(m.record(uid, cfg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 2 {
+		t.Fatalf("%d files written, want 2", len(files))
+	}
+	w.abort()
+	if files, _ := os.ReadDir(dir); len(files) > 0 {
+		t.Errorf("files left behind: %v", files)
+	}
+}
+
+func TestSitemapIndexAbort(t *testing.T) {
+	m := testSite(map[int]int{1: 0, 2: 1})
+	dir := t.TempDir()
+	cfg := &outputConfig{format: "sitemap"}
+	var b bytes.Buffer
+	next := newSplitWriter(cfg, m, filepath.Join(dir, "sitemap-{n}.xml"), 1)
+	w := newSitemapIndexWriter(&b, "https://example.com/sitemap-{n}.xml", next)
+	for uid := 1; uid <= 2; uid++ {
+		if err := w.write(m.record(uid, cfg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !abortOutput(w) {
+		t.Fatal("sitemap index writer cannot be aborted")
+	}
+	if files, _ := os.ReadDir(dir); len(files) > 0 {
+		t.Errorf("files left behind: %v", files)
+	}
+	if b.Len() > 0 {
+		t.Errorf("index written: %s", b.String())
+	}
+}
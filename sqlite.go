@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE pages (
+	uid INTEGER PRIMARY KEY,
+	pid INTEGER NOT NULL,
+	is_siteroot INTEGER NOT NULL,
+	sorting INTEGER NOT NULL,
+	slug TEXT,
+	title TEXT,
+	tstamp INTEGER,
+	doktype INTEGER,
+	sys_language_uid INTEGER,
+	l10n_parent INTEGER
+);
+CREATE INDEX pages_pid ON pages (pid);
+CREATE TABLE domains (
+	pid INTEGER PRIMARY KEY,
+	domain TEXT NOT NULL,
+	forced INTEGER NOT NULL
+);
+`
+
+// writeSQLite dumps the loaded pages and domains to a new SQLite
+// database in fname. Columns that were not loaded are NULL, and
+// is_siteroot is set for all detected roots. The database is written
+// to a temporary file renamed to fname on success, so that a failed
+// or interrupted export leaves nothing behind.
+func (m *mysql) writeSQLite(ctx context.Context, fname string) error {
+	if _, err := os.Stat(fname); err == nil {
+		return fmt.Errorf("%s already exists", fname)
+	}
+	f, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	if err := m.fillSQLite(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fname)
+}
+
+// fillSQLite creates the tables in the empty database fname and
+// inserts the pages and domains.
+func (m *mysql) fillSQLite(ctx context.Context, fname string) error {
+	db, err := sql.Open("sqlite", fname)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		return fmt.Errorf("cannot create tables: %v", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := m.insertPages(ctx, tx); err != nil {
+		return fmt.Errorf("cannot insert pages: %v", err)
+	}
+	if err := m.insertDomains(ctx, tx); err != nil {
+		return fmt.Errorf("cannot insert domains: %v", err)
+	}
+	return tx.Commit()
+}
+
+func (m *mysql) insertPages(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO pages VALUES (?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	uids := make([]int, 0, len(m.pages))
+	for uid := range m.pages {
+		uids = append(uids, uid)
+	}
+	sort.Ints(uids)
+	for _, uid := range uids {
+		var slug, title, tstamp, doktype, lang, l10nParent interface{}
+		if m.opts.slugs {
+			slug = m.slugs[uid]
+		}
+		if m.opts.titles {
+			title = m.titles[uid]
+		}
+		if m.opts.tstamps {
+			tstamp = m.tstamps[uid]
+		}
+		if m.opts.doktypes {
+			doktype = m.doktypes[uid]
+		}
+		if m.opts.languages || m.opts.pageLangs {
+			lang, l10nParent = m.langs[uid], m.l10nOf[uid]
+		}
+		_, err := stmt.ExecContext(ctx, uid, m.pages[uid], m.isRoot(uid), m.sorting[uid],
+			slug, title, tstamp, doktype, lang, l10nParent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mysql) insertDomains(ctx context.Context, tx *sql.Tx) error {
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO domains VALUES (?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for pid, domain := range m.domains {
+		if _, err := stmt.ExecContext(ctx, pid, domain, m.forced[pid]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
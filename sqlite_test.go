@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSQLite(t *testing.T) {
+	m := &mysql{
+		pages:   map[int]int{1: 0, 2: 1},
+		sorting: map[int]int{1: 256, 2: 512},
+		domains: map[int]string{1: "example.com"},
+		forced:  map[int]bool{1: true},
+		roots:   []int{1},
+	}
+	fname := filepath.Join(t.TempDir(), "tree.sqlite")
+	if err := m.writeSQLite(context.Background(), fname); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var domain string
+	var forced bool
+	if err := db.QueryRow("SELECT domain,forced FROM domains WHERE pid=1").Scan(&domain, &forced); err != nil {
+		t.Fatal(err)
+	}
+	if domain != "example.com" || !forced {
+		t.Errorf("domain of 1 is %q, forced %v", domain, forced)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pages WHERE is_siteroot=1").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("%d roots, want 1", n)
+	}
+}
+
+func TestWriteSQLiteCancelled(t *testing.T) {
+	m := &mysql{pages: map[int]int{1: 0}, sorting: map[int]int{}}
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.writeSQLite(ctx, filepath.Join(dir, "tree.sqlite")); err == nil {
+		t.Fatal("no error with a cancelled context")
+	}
+	if files, _ := os.ReadDir(dir); len(files) > 0 {
+		t.Errorf("files left behind: %v", files)
+	}
+}